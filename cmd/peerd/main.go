@@ -1,15 +1,22 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"errors"
 	"flag"
-	"reflect"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/ravenix/peerd/internal/config"
-	"github.com/ravenix/peerd/internal/group"
-	"github.com/ravenix/peerd/pkg/explorer"
-	"github.com/ravenix/peerd/pkg/plugin"
+	"github.com/ravenix/peerd/internal/metrics"
+	"github.com/ravenix/peerd/internal/state"
+	"github.com/ravenix/peerd/internal/status"
+	"github.com/ravenix/peerd/internal/supervisor"
 	_ "github.com/ravenix/peerd/plugin/exec"
 	_ "github.com/ravenix/peerd/plugin/keepalived"
 	_ "github.com/ravenix/peerd/plugin/kubernetes"
@@ -20,61 +27,82 @@ import (
 )
 
 var conf string
+var watchInterval time.Duration
 
 func init() {
 	flag.StringVar(&conf, "config", "/etc/peerd/peerd.yaml", "Configuration file")
+	flag.DurationVar(&watchInterval, "watch-interval", 0, "Interval for checking the configuration file for changes, 0 disables watching")
 }
 
-func runGroupCycle(g *group.Group, cadence explorer.Cadence) {
-	for _, h := range g.Handlers {
-		if err := h.PreExploration(context.Background(), g.GetPeers()); err != nil {
-			log.Warnf("Failed running pre-exploration hook for group '%s' of handler '%s': %v", g.Name, reflect.TypeOf(h).String(), err)
-		}
+func configChecksum(filename string) []byte {
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		return nil
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), cadence.ExploreTimeout)
-	defer cancel()
+	checksum := sha256.Sum256(contents)
+	return checksum[:]
+}
 
-	for _, e := range g.Explorers {
-		go func(currentExplorer explorer.Explorer) {
-			if err := currentExplorer.Explore(ctx, g); err != nil {
-				log.Warnf("Failed exploring peers for group '%s' with explorer '%s': %v", g.Name, reflect.TypeOf(currentExplorer).String(), err)
-			}
-		}(e)
+func reload(sup *supervisor.Supervisor, cfg *config.Config) *config.Config {
+	log.Infof("Reloading configuration %v", conf)
+
+	newCfg, err := config.NewConfig(conf)
+	if err != nil {
+		log.Errorf("Rejecting configuration reload, could not load configuration file: %v", err)
+		return cfg
 	}
 
-	<-ctx.Done()
+	if err := sup.Apply(newCfg); err != nil {
+		log.Errorf("Rejecting configuration reload: %v", err)
+		return cfg
+	}
 
-	peers, newPeers, lostPeers := g.Reconcile(context.Background(), cadence.PeerTTL)
+	if newCfg.HTTP != cfg.HTTP {
+		log.Warnf("Changes to the HTTP API configuration require a restart")
+	}
 
-	for _, h := range g.Handlers {
-		if err := h.PostExploration(context.Background(), peers, newPeers, lostPeers); err != nil {
-			log.Warnf("Failed running post-exploration hook for group '%s' of handler '%s': %v", g.Name, reflect.TypeOf(h).String(), err)
-		}
+	if newCfg.State.Directory != cfg.State.Directory {
+		log.Warnf("Changes to the state directory require a restart")
 	}
+
+	log.SetLevel(newCfg.LogLevel)
+	log.Infof("Configuration reloaded")
+	return newCfg
 }
 
-func runGroup(g *group.Group) {
-	cadence := explorer.ResolveCadence(g.Explorers)
-	log.Infof(
-		"Group '%s' cadence interval=%s timeout=%s peer_ttl=%s",
-		g.Name,
-		cadence.ExploreInterval,
-		cadence.ExploreTimeout,
-		cadence.PeerTTL,
-	)
-
-	ticker := time.NewTicker(cadence.ExploreInterval)
-	defer ticker.Stop()
-
-	for {
-		runGroupCycle(g, cadence)
-		<-ticker.C
+func startHTTPServer(listen string, sup *supervisor.Supervisor) *http.Server {
+	mux := http.NewServeMux()
+	status.Register(mux, sup)
+	mux.Handle("GET /metrics", metrics.Handler())
+
+	server := &http.Server{
+		Addr:    listen,
+		Handler: mux,
 	}
+
+	go func() {
+		log.Infof("Serving HTTP API on %s", listen)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("HTTP API could not be served on %s: %v", listen, err)
+		}
+	}()
+
+	return server
 }
 
 func main() {
 	flag.Parse()
+
+	if flag.NArg() > 0 {
+		switch flag.Arg(0) {
+		case "validate":
+			os.Exit(runValidate(flag.Args()[1:], os.Stdout, os.Stderr))
+		default:
+			log.Fatalf("Unknown command '%s'", flag.Arg(0))
+		}
+	}
+
 	log.Infof("Configuration %v", conf)
 	cfg, err := config.NewConfig(conf)
 
@@ -84,43 +112,78 @@ func main() {
 
 	log.SetLevel(cfg.LogLevel)
 
-	groups := make([]*group.Group, 0)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	for cgn, cg := range cfg.Groups {
-		currentGroup := &group.Group{
-			Name: cgn,
+	var store *state.Store
+	if cfg.State.Directory != "" {
+		store, err = state.NewStore(cfg.State.Directory)
+		if err != nil {
+			log.Fatalf("Error while opening state directory: %v", err)
 		}
+	}
 
-		for _, ce := range cg.Explorers {
-			if e, err := plugin.InitializeExplorer(ce.Name, &ce.Configuration); err == nil {
-				currentGroup.Explorers = append(currentGroup.Explorers, e)
-			} else {
-				log.Fatalf("Could not initialize explorer '%s' for group '%s': %v", ce.Name, cgn, err)
-			}
-		}
+	sup := supervisor.New(ctx, store)
+	if err := sup.Apply(cfg); err != nil {
+		log.Fatalf("Error while applying configuration: %v", err)
+	}
 
-		for _, ch := range cg.Handlers {
-			if h, err := plugin.InitializeHandler(ch.Name, &ch.Configuration); err == nil {
-				currentGroup.Handlers = append(currentGroup.Handlers, h)
-			} else {
-				log.Fatalf("Could not initialize handler '%s' for group '%s': %v", ch.Name, cgn, err)
-			}
-		}
+	var httpServer *http.Server
+	if cfg.HTTP.Listen != "" {
+		httpServer = startHTTPServer(cfg.HTTP.Listen, sup)
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
 
-		groups = append(groups, currentGroup)
+	var watchC <-chan time.Time
+	lastChecksum := configChecksum(conf)
+	if watchInterval > 0 {
+		watchTicker := time.NewTicker(watchInterval)
+		defer watchTicker.Stop()
+		watchC = watchTicker.C
 	}
 
-	for _, g := range groups {
-		for _, e := range g.Explorers {
-			go func(currentExplorer explorer.Explorer, currentGroup *group.Group) {
-				if err := currentExplorer.Run(context.Background()); err != nil {
-					log.Fatalf("Explorer '%s' for group '%s' could not be run: %v", reflect.TypeOf(currentExplorer).String(), currentGroup.Name, err)
-				}
-			}(e, g)
+	exitCode := 0
+	for running := true; running; {
+		select {
+		case <-ctx.Done():
+			running = false
+		case <-sup.Failed():
+			exitCode = 1
+			running = false
+		case <-hup:
+			lastChecksum = configChecksum(conf)
+			cfg = reload(sup, cfg)
+		case <-watchC:
+			checksum := configChecksum(conf)
+			if checksum == nil || bytes.Equal(checksum, lastChecksum) {
+				continue
+			}
+
+			lastChecksum = checksum
+			cfg = reload(sup, cfg)
 		}
+	}
+
+	stop()
+
+	log.Infof("Shutting down, waiting up to %s for running cycles", cfg.ShutdownTimeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
 
-		go runGroup(g)
+	if httpServer != nil {
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			log.Warnf("Failed shutting down HTTP API: %v", err)
+		}
 	}
 
-	select {}
+	sup.Shutdown(shutdownCtx)
+
+	log.Infof("Shutdown complete")
+
+	if exitCode != 0 {
+		os.Exit(exitCode)
+	}
 }
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/ravenix/peerd/internal/config"
+	"github.com/ravenix/peerd/internal/supervisor"
+	"github.com/ravenix/peerd/pkg/plugin"
+	"gopkg.in/yaml.v3"
+)
+
+func runValidate(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&conf, "config", conf, "Configuration file")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := config.NewStrictConfig(conf)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", conf, err)
+		return 1
+	}
+
+	groupNames := make([]string, 0, len(cfg.Groups))
+	for cgn := range cfg.Groups {
+		groupNames = append(groupNames, cgn)
+	}
+	sort.Strings(groupNames)
+
+	problems := 0
+	report := func(groupName string, kind string, name string, line int, column int, configuration *yaml.Node, err error) {
+		var decodeErr *plugin.DecodeError
+		if errors.As(err, &decodeErr) {
+			line, column = decodeErr.Line, decodeErr.Column
+			err = errors.New(decodeErr.Message)
+		} else if configuration.Kind != 0 {
+			line, column = configuration.Line, configuration.Column
+		}
+
+		fmt.Fprintf(stderr, "%s:%d:%d: group '%s' %s '%s': %v\n", conf, line, column, groupName, kind, name, err)
+		problems++
+	}
+
+	for _, cgn := range groupNames {
+		cg := cfg.Groups[cgn]
+
+		if err := supervisor.ValidateGroup(&cg); err != nil {
+			var settingsErr *supervisor.SettingsError
+			if errors.As(err, &settingsErr) {
+				line, column := settingsErr.Position(&cg)
+				fmt.Fprintf(stderr, "%s:%d:%d: group '%s': %v\n", conf, line, column, cgn, err)
+			} else {
+				fmt.Fprintf(stderr, "%s: group '%s': %v\n", conf, cgn, err)
+			}
+			problems++
+		}
+
+		for idx := range cg.Explorers {
+			ce := &cg.Explorers[idx]
+			if err := plugin.ValidateExplorer(ce.Name, &ce.Configuration); err != nil {
+				report(cgn, "explorer", ce.Name, ce.Line, ce.Column, &ce.Configuration, err)
+			}
+		}
+
+		for idx := range cg.Handlers {
+			ch := &cg.Handlers[idx]
+			if err := plugin.ValidateHandler(ch.Name, &ch.Configuration); err != nil {
+				report(cgn, "handler", ch.Name, ch.Line, ch.Column, &ch.Configuration, err)
+			}
+		}
+	}
+
+	if problems > 0 {
+		fmt.Fprintf(stderr, "%s: %d problem(s) found\n", conf, problems)
+		return 1
+	}
+
+	fmt.Fprintf(stdout, "%s: configuration is valid\n", conf)
+	return 0
+}
@@ -1,34 +1,249 @@
 package config
 
 import (
+	"bytes"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	yaml "gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	LogLevel log.Level        `yaml:"log_level"`
-	Groups   map[string]Group `yaml:"groups"`
+	LogLevel        log.Level        `yaml:"log_level"`
+	ShutdownTimeout time.Duration    `yaml:"shutdown_timeout"`
+	HTTP            HTTP             `yaml:"http"`
+	State           State            `yaml:"state"`
+	Groups          map[string]Group `yaml:"groups"`
+}
+
+type HTTP struct {
+	Listen string `yaml:"listen"`
+}
+
+type State struct {
+	Directory   string        `yaml:"directory"`
+	GracePeriod time.Duration `yaml:"grace_period"`
 }
 
 type Group struct {
+	Cadence   Cadence    `yaml:"cadence"`
+	Merge     Merge      `yaml:"merge"`
+	Damping   Damping    `yaml:"damping"`
 	Explorers []Explorer `yaml:"explorers"`
 	Handlers  []Handler  `yaml:"handlers"`
 }
 
+type Cadence struct {
+	Interval time.Duration `yaml:"interval"`
+	Timeout  time.Duration `yaml:"timeout"`
+	PeerTTL  time.Duration `yaml:"peer_ttl"`
+
+	Line   int `yaml:"-"`
+	Column int `yaml:"-"`
+}
+
+type Merge struct {
+	Match string `yaml:"match"`
+	Label string `yaml:"label"`
+
+	Line   int `yaml:"-"`
+	Column int `yaml:"-"`
+}
+
+type Damping struct {
+	UpCycles   int           `yaml:"up_cycles"`
+	DownCycles int           `yaml:"down_cycles"`
+	DownAfter  time.Duration `yaml:"down_after"`
+
+	FlapPenalty       float64       `yaml:"flap_penalty"`
+	HalfLife          time.Duration `yaml:"half_life"`
+	SuppressThreshold float64       `yaml:"suppress_threshold"`
+	ReuseThreshold    float64       `yaml:"reuse_threshold"`
+
+	Line   int `yaml:"-"`
+	Column int `yaml:"-"`
+}
+
 type Explorer struct {
 	Name          string    `yaml:"name"`
 	Configuration yaml.Node `yaml:"configuration"`
+	Cadence       Cadence   `yaml:"cadence"`
+
+	Line   int `yaml:"-"`
+	Column int `yaml:"-"`
 }
 
 type Handler struct {
+	ID            string    `yaml:"id"`
 	Name          string    `yaml:"name"`
 	Configuration yaml.Node `yaml:"configuration"`
+	After         []string  `yaml:"after"`
+
+	Timeout   time.Duration `yaml:"timeout"`
+	Retries   int           `yaml:"retries"`
+	Backoff   time.Duration `yaml:"backoff"`
+	OnFailure string        `yaml:"on_failure"`
+
+	Line   int `yaml:"-"`
+	Column int `yaml:"-"`
+}
+
+func (c *Cadence) UnmarshalYAML(node *yaml.Node) error {
+	type plain Cadence
+	if err := node.Decode((*plain)(c)); err != nil {
+		return err
+	}
+
+	c.Line, c.Column = node.Line, node.Column
+	return nil
+}
+
+func (m *Merge) UnmarshalYAML(node *yaml.Node) error {
+	type plain Merge
+	if err := node.Decode((*plain)(m)); err != nil {
+		return err
+	}
+
+	m.Line, m.Column = node.Line, node.Column
+	return nil
+}
+
+func (d *Damping) UnmarshalYAML(node *yaml.Node) error {
+	type plain Damping
+	if err := node.Decode((*plain)(d)); err != nil {
+		return err
+	}
+
+	d.Line, d.Column = node.Line, node.Column
+	return nil
+}
+
+func (e *Explorer) UnmarshalYAML(node *yaml.Node) error {
+	type plain Explorer
+	if err := node.Decode((*plain)(e)); err != nil {
+		return err
+	}
+
+	e.Line, e.Column = node.Line, node.Column
+	return nil
+}
+
+func (h *Handler) UnmarshalYAML(node *yaml.Node) error {
+	type plain Handler
+	if err := node.Decode((*plain)(h)); err != nil {
+		return err
+	}
+
+	h.Line, h.Column = node.Line, node.Column
+	return nil
+}
+
+var (
+	cadenceKeys  = []string{"interval", "timeout", "peer_ttl"}
+	mergeKeys    = []string{"match", "label"}
+	dampingKeys  = []string{"up_cycles", "down_cycles", "down_after", "flap_penalty", "half_life", "suppress_threshold", "reuse_threshold"}
+	explorerKeys = []string{"name", "configuration", "cadence"}
+	handlerKeys  = []string{"id", "name", "configuration", "after", "timeout", "retries", "backoff", "on_failure"}
+)
+
+// checkGroupKeys rejects unknown keys in the entries of the groups. The
+// entries decode themselves to record their position, which escapes the
+// KnownFields setting of the decoder, so strict loading walks them instead.
+func checkGroupKeys(document *yaml.Node) error {
+	groups := mappingValue(document, "groups")
+	if groups == nil || groups.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for idx := 1; idx < len(groups.Content); idx += 2 {
+		group := groups.Content[idx]
+		checks := []struct {
+			node     *yaml.Node
+			typeName string
+			keys     []string
+		}{
+			{mappingValue(group, "cadence"), "config.Cadence", cadenceKeys},
+			{mappingValue(group, "merge"), "config.Merge", mergeKeys},
+			{mappingValue(group, "damping"), "config.Damping", dampingKeys},
+		}
+		for _, check := range checks {
+			if err := checkEntryKeys(check.node, check.typeName, check.keys...); err != nil {
+				return err
+			}
+		}
+
+		if explorers := mappingValue(group, "explorers"); explorers != nil && explorers.Kind == yaml.SequenceNode {
+			for _, e := range explorers.Content {
+				if err := checkEntryKeys(e, "config.Explorer", explorerKeys...); err != nil {
+					return err
+				}
+
+				if err := checkEntryKeys(mappingValue(e, "cadence"), "config.Cadence", cadenceKeys...); err != nil {
+					return err
+				}
+			}
+		}
+
+		if handlers := mappingValue(group, "handlers"); handlers != nil && handlers.Kind == yaml.SequenceNode {
+			for _, h := range handlers.Content {
+				if err := checkEntryKeys(h, "config.Handler", handlerKeys...); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// mappingValue returns the value of the key in the mapping, or nil.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node != nil && node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for idx := 0; idx+1 < len(node.Content); idx += 2 {
+		if node.Content[idx].Value == key {
+			return node.Content[idx+1]
+		}
+	}
+
+	return nil
+}
+
+func checkEntryKeys(node *yaml.Node, typeName string, keys ...string) error {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for idx := 0; idx+1 < len(node.Content); idx += 2 {
+		key := node.Content[idx]
+		if !slices.Contains(keys, key.Value) {
+			return fmt.Errorf("line %d: field %s not found in type %s", key.Line, key.Value, typeName)
+		}
+	}
+
+	return nil
 }
 
 func NewConfig(filename string) (*Config, error) {
+	return load(filename, false)
+}
+
+func NewStrictConfig(filename string) (*Config, error) {
+	return load(filename, true)
+}
+
+func load(filename string, strict bool) (*Config, error) {
 	absFilename, err := filepath.Abs(filename)
 	if err != nil {
 		return nil, err
@@ -40,13 +255,31 @@ func NewConfig(filename string) (*Config, error) {
 	}
 
 	config := Config{
-		LogLevel: log.InfoLevel,
+		LogLevel:        log.InfoLevel,
+		ShutdownTimeout: 10 * time.Second,
+		State: State{
+			GracePeriod: 30 * time.Second,
+		},
 	}
 
-	err = yaml.Unmarshal(yamlFile, &config)
-	if err != nil {
+	decoder := yaml.NewDecoder(bytes.NewReader(yamlFile))
+	decoder.KnownFields(strict)
+
+	err = decoder.Decode(&config)
+	if err != nil && err != io.EOF {
 		return nil, err
 	}
 
+	if strict {
+		var document yaml.Node
+		if err := yaml.Unmarshal(yamlFile, &document); err != nil {
+			return nil, err
+		}
+
+		if err := checkGroupKeys(&document); err != nil {
+			return nil, err
+		}
+	}
+
 	return &config, nil
 }
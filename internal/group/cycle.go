@@ -0,0 +1,283 @@
+package group
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ravenix/peerd/pkg/explorer"
+	log "github.com/sirupsen/logrus"
+)
+
+// cycle is a run of the explorers which were due at the same time. It is
+// reconciled once all of them returned or ran out of time, while explorers
+// on other cadences keep being scheduled.
+type cycle struct {
+	started time.Time
+	idle    map[string]bool
+	pending int
+	failed  bool
+}
+
+// explored is sent to the loop of the group when an explorer of a cycle
+// returned.
+type explored struct {
+	cycle *cycle
+	err   error
+}
+
+// Run schedules every explorer on its own cadence. Whenever explorers are due
+// a cycle starts them, and reconciles as soon as all of them returned or ran
+// out of time. Changes reported by streaming explorers are reconciled right
+// away.
+func (g *Group) Run(ctx context.Context) {
+	cadence := g.resolveCadence()
+	log.Infof(
+		"Group '%s' cadence interval=%s timeout=%s peer_ttl=%s",
+		g.Name,
+		cadence.ExploreInterval,
+		cadence.ExploreTimeout,
+		cadence.PeerTTL,
+	)
+
+	pull := g.pullExplorers()
+	for _, idx := range pull {
+		for _, problem := range g.explorerCadence(idx).Problems() {
+			log.Warnf("Explorer '%s' of group '%s' cadence is contradictory: %s", g.explorerName(idx), g.Name, problem)
+		}
+	}
+
+	g.resetStatus(cadence)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	events := g.eventQueue()
+	results := make(chan explored, len(g.Explorers))
+	next := make([]time.Time, len(g.Explorers))
+	for {
+		now := time.Now()
+		wakeup := now.Add(cadence.ExploreInterval)
+
+		var due []int
+		for _, idx := range pull {
+			if !next[idx].After(now) {
+				due = append(due, idx)
+				next[idx] = now.Add(g.explorerCadence(idx).ExploreInterval)
+			}
+
+			if next[idx].Before(wakeup) {
+				wakeup = next[idx]
+			}
+		}
+
+		if len(due) > 0 || len(pull) == 0 {
+			if c := g.startCycle(ctx, &wg, due, results); c.pending == 0 {
+				g.finishCycle(ctx, c)
+			}
+		}
+
+		if !g.wait(ctx, wakeup, events, results) {
+			return
+		}
+	}
+}
+
+// wait sleeps until wakeup, finishing cycles whose explorers all returned and
+// running a cycle without explorers whenever streaming explorers report
+// changes. It returns false once ctx is done.
+func (g *Group) wait(ctx context.Context, wakeup time.Time, events chan event, results chan explored) bool {
+	timer := time.NewTimer(time.Until(wakeup))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-timer.C:
+			return true
+		case r := <-results:
+			if g.explored(r) {
+				g.finishCycle(ctx, r.cycle)
+			}
+		case ev := <-events:
+			g.applyEvents(ev, events)
+			g.runCycle(ctx, nil)
+		}
+	}
+}
+
+// runCycle runs the due explorers and reconciles once all of them returned.
+func (g *Group) runCycle(ctx context.Context, due []int) {
+	var wg sync.WaitGroup
+	results := make(chan explored, len(due))
+
+	c := g.startCycle(ctx, &wg, due, results)
+	for c.pending > 0 {
+		g.explored(<-results)
+	}
+
+	g.finishCycle(ctx, c)
+}
+
+// pullExplorers returns the indexes of the explorers which are asked for their
+// peers, all but the streaming ones.
+func (g *Group) pullExplorers() []int {
+	var pull []int
+	for idx := range g.Explorers {
+		if !g.streaming(idx) {
+			pull = append(pull, idx)
+		}
+	}
+
+	return pull
+}
+
+// explorerCadence is the cadence of an explorer with the overrides of the
+// group applied, and those configured for the explorer on top.
+func (g *Group) explorerCadence(idx int) explorer.Cadence {
+	cadence := explorer.ExplorerCadence(g.Explorers[idx]).Override(g.CadenceOverride)
+	if idx < len(g.ExplorerCadenceOverrides) {
+		cadence = cadence.Override(g.ExplorerCadenceOverrides[idx])
+	}
+
+	return cadence
+}
+
+// resolveCadence combines the cadences of the explorers which are asked for
+// their peers. It is reported as the cadence of the group, and its peer TTL
+// applies to peers no explorer reported.
+func (g *Group) resolveCadence() explorer.Cadence {
+	pull := g.pullExplorers()
+	if len(pull) == 0 {
+		return explorer.DefaultCadence().Override(g.CadenceOverride)
+	}
+
+	cadences := make([]explorer.Cadence, 0, len(pull))
+	for _, idx := range pull {
+		cadences = append(cadences, g.explorerCadence(idx))
+	}
+
+	return explorer.CombineCadences(cadences)
+}
+
+// startCycle runs the pre-exploration hooks and starts the due explorers, each
+// of which sends to results when it returned. Peers discovered only by
+// explorers which were not due are left as they are when the cycle finishes.
+func (g *Group) startCycle(ctx context.Context, wg *sync.WaitGroup, due []int, results chan<- explored) *cycle {
+	c := &cycle{
+		started: time.Now(),
+		idle:    make(map[string]bool, len(g.Explorers)),
+	}
+
+	currentPeers := g.GetPeers()
+	g.runHandlers(HookPreExploration, func(idx int) error {
+		h := g.Handlers[idx]
+		err := g.callHandler(ctx, idx, HookPreExploration, func(ctx context.Context) error { return h.PreExploration(ctx, currentPeers) })
+		if err != nil {
+			log.Warnf("Failed running pre-exploration hook for group '%s' of handler '%s': %v", g.Name, g.handlerName(idx), err)
+		}
+		return err
+	}, nil)
+
+	for _, idx := range g.pullExplorers() {
+		c.idle[g.sourceName(idx)] = true
+	}
+
+	for _, idx := range due {
+		source := g.sourceName(idx)
+		delete(c.idle, source)
+
+		running := g.exploring(g.Explorers[idx])
+		if !running.CompareAndSwap(false, true) {
+			log.Warnf("Explorer '%s' of group '%s' is still running, skipping it this cycle", g.explorerName(idx), g.Name)
+			continue
+		}
+
+		cadence := g.explorerCadence(idx)
+		dh := &sourceHandler{group: g, source: source, ttl: cadence.PeerTTL}
+
+		c.pending++
+		wg.Add(1)
+		go func(idx int, name string, currentExplorer explorer.Explorer) {
+			defer wg.Done()
+
+			exploreStarted := time.Now()
+			err := runHook(ctx, cadence.ExploreTimeout, func(ctx context.Context) error {
+				defer running.Store(false)
+				return currentExplorer.Explore(ctx, dh)
+			})
+			g.recordExplorer(idx, name, exploreStarted, err)
+
+			if err != nil {
+				log.Warnf("Failed exploring peers for group '%s' with explorer '%s': %v", g.Name, name, err)
+			}
+
+			results <- explored{cycle: c, err: err}
+		}(idx, g.explorerName(idx), g.Explorers[idx])
+	}
+
+	return c
+}
+
+// explored records that an explorer of a cycle returned. It tells whether
+// that was the last one the cycle waited for.
+func (g *Group) explored(r explored) bool {
+	r.cycle.pending--
+	r.cycle.failed = r.cycle.failed || r.err != nil
+	return r.cycle.pending == 0
+}
+
+// finishCycle reconciles what the explorers of the cycle reported.
+func (g *Group) finishCycle(ctx context.Context, c *cycle) {
+	if ctx.Err() != nil {
+		log.Debugf("Group '%s' cycle interrupted, skipping reconciliation", g.Name)
+		return
+	}
+
+	peers, newPeers, lostPeers := g.reconcile(ctx, g.resolveCadence().PeerTTL, c.idle)
+	g.saveState(peers)
+
+	g.runHandlers(HookPostExploration, func(idx int) error {
+		h := g.Handlers[idx]
+		err := g.callHandler(ctx, idx, HookPostExploration, func(ctx context.Context) error { return h.PostExploration(ctx, peers, newPeers, lostPeers) })
+		if err != nil {
+			log.Warnf("Failed running post-exploration hook for group '%s' of handler '%s': %v", g.Name, g.handlerName(idx), err)
+		}
+		return err
+	}, nil)
+
+	g.recordCycle(c.started, peers, newPeers, lostPeers, !c.failed)
+}
+
+// exploring tells whether an explorer is still busy with an earlier cycle, so
+// that a slow explorer is never called twice at once. The guard belongs to the
+// explorer, and outlives a reload moving it within the group.
+func (g *Group) exploring(e explorer.Explorer) *atomic.Bool {
+	g.statusMu.Lock()
+	defer g.statusMu.Unlock()
+
+	if g.running == nil {
+		g.running = make(map[explorer.Explorer]*atomic.Bool)
+	}
+
+	running := g.running[e]
+	if running == nil {
+		running = &atomic.Bool{}
+		g.running[e] = running
+	}
+
+	return running
+}
+
+// forgetExplorers drops the guards of explorers which left the group and are
+// no longer busy. g.statusMu must be held.
+func (g *Group) forgetExplorers() {
+	for e, running := range g.running {
+		if !slices.Contains(g.Explorers, e) && !running.Load() {
+			delete(g.running, e)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package group
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/ravenix/peerd/internal/peer"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DampingPending    = "pending"
+	DampingMissing    = "missing"
+	DampingSuppressed = "suppressed"
+)
+
+// Damping holds back membership changes of peers which only briefly appear or
+// disappear. The zero value announces a peer on the first cycle it is seen in
+// and declares it lost as soon as its TTL expired.
+//
+// A peer which is declared lost accrues FlapPenalty. The penalty halves every
+// HalfLife; while it is above SuppressThreshold the peer is not announced
+// again, until it decayed below ReuseThreshold.
+type Damping struct {
+	UpCycles   int
+	DownCycles int
+	DownAfter  time.Duration
+
+	FlapPenalty       float64
+	HalfLife          time.Duration
+	SuppressThreshold float64
+	ReuseThreshold    float64
+}
+
+type DampingStatus struct {
+	Peer    *peer.Peer
+	State   string
+	Cycles  int
+	Since   time.Time
+	Penalty float64
+}
+
+// flap is the decaying penalty of one source key, kept across losses of the
+// peer so that a rediscovered peer inherits it.
+type flap struct {
+	penalty    float64
+	updated    time.Time
+	suppressed bool
+}
+
+func (d Damping) Validate() error {
+	if d.UpCycles < 0 || d.DownCycles < 0 || d.DownAfter < 0 {
+		return fmt.Errorf("cycles and durations must not be negative")
+	}
+
+	if d.FlapPenalty < 0 {
+		return fmt.Errorf("flap penalty must not be negative")
+	}
+
+	if d.FlapPenalty == 0 {
+		if d.HalfLife != 0 || d.SuppressThreshold != 0 || d.ReuseThreshold != 0 {
+			return fmt.Errorf("half life and thresholds require a flap penalty")
+		}
+
+		return nil
+	}
+
+	if d.HalfLife <= 0 {
+		return fmt.Errorf("half life must be positive")
+	}
+
+	if d.SuppressThreshold <= 0 || d.ReuseThreshold <= 0 || d.ReuseThreshold >= d.SuppressThreshold {
+		return fmt.Errorf("reuse threshold must be positive and below the suppress threshold")
+	}
+
+	return nil
+}
+
+func (d Damping) announce(st *peerState) bool {
+	return st.seenCycles >= max(d.UpCycles, 1)
+}
+
+func (d Damping) lost(st *peerState, now time.Time) bool {
+	if d.DownCycles <= 0 && d.DownAfter <= 0 {
+		return true
+	}
+
+	if d.DownCycles > 0 && st.missingCycles >= d.DownCycles {
+		return true
+	}
+
+	return d.DownAfter > 0 && now.Sub(st.missingSince) >= d.DownAfter
+}
+
+func (d Damping) decay(f *flap, now time.Time) {
+	if elapsed := now.Sub(f.updated); elapsed > 0 {
+		f.penalty *= math.Exp2(-elapsed.Seconds() / d.HalfLife.Seconds())
+	}
+	f.updated = now
+}
+
+// penalize charges a lost peer with the flap penalty on every source key it
+// was ever discovered under.
+func (g *Group) penalize(p *peer.Peer, st *peerState, now time.Time) {
+	if g.Damping.FlapPenalty <= 0 {
+		return
+	}
+
+	if g.flaps == nil {
+		g.flaps = make(map[string]*flap)
+	}
+
+	for key := range st.keys {
+		f, ok := g.flaps[key]
+		if !ok {
+			f = &flap{updated: now}
+			g.flaps[key] = f
+		}
+
+		g.Damping.decay(f, now)
+		f.penalty += g.Damping.FlapPenalty
+
+		if !f.suppressed && f.penalty >= g.Damping.SuppressThreshold {
+			f.suppressed = true
+			log.Infof("Suppressing peer %v of group '%s' after repeated flaps (penalty %.0f)", p, g.Name, f.penalty)
+		}
+	}
+}
+
+func (g *Group) suppressed(p *peer.Peer, st *peerState, now time.Time) bool {
+	if g.Damping.FlapPenalty <= 0 {
+		return false
+	}
+
+	suppressed := false
+	for key := range st.keys {
+		f, ok := g.flaps[key]
+		if !ok {
+			continue
+		}
+
+		g.Damping.decay(f, now)
+		if f.suppressed && f.penalty < g.Damping.ReuseThreshold {
+			f.suppressed = false
+			log.Infof("Reusing peer %v of group '%s', flap penalty decayed to %.0f", p, g.Name, f.penalty)
+		}
+
+		suppressed = suppressed || f.suppressed
+	}
+
+	return suppressed
+}
+
+func (g *Group) penalty(st *peerState, now time.Time) float64 {
+	var penalty float64
+	for key := range st.keys {
+		if f, ok := g.flaps[key]; ok {
+			decayed := *f
+			g.Damping.decay(&decayed, now)
+			penalty = max(penalty, decayed.penalty)
+		}
+	}
+
+	return penalty
+}
+
+// forgetFlaps drops penalties which decayed to nothing.
+func (g *Group) forgetFlaps(now time.Time) {
+	if g.Damping.FlapPenalty <= 0 {
+		g.flaps = nil
+		return
+	}
+
+	for key, f := range g.flaps {
+		g.Damping.decay(f, now)
+		if !f.suppressed && f.penalty < 1 {
+			delete(g.flaps, key)
+		}
+	}
+}
+
+func (g *Group) DampingStatus() []DampingStatus {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	now := time.Now()
+	var statuses []DampingStatus
+	for _, p := range g.peers {
+		st := g.state[p]
+		if st == nil {
+			continue
+		}
+
+		s := DampingStatus{Penalty: g.penalty(st, now)}
+		switch {
+		case p.LastSeen.IsZero() && st.suppressed:
+			s.State = DampingSuppressed
+			s.Cycles = st.seenCycles
+		case p.LastSeen.IsZero():
+			s.State = DampingPending
+			s.Cycles = st.seenCycles
+		case st.missingCycles > 0:
+			s.State = DampingMissing
+			s.Cycles = st.missingCycles
+			s.Since = st.missingSince
+		default:
+			continue
+		}
+
+		tmpP := *p
+		s.Peer = &tmpP
+		statuses = append(statuses, s)
+	}
+
+	return statuses
+}
@@ -2,8 +2,8 @@ package group
 
 import (
 	"context"
-	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ravenix/peerd/internal/peer"
@@ -14,41 +14,218 @@ import (
 )
 
 type Group struct {
-	Name      string
-	Explorers []explorer.Explorer
-	Handlers  []handler.Handler
+	Name                string
+	Explorers           []explorer.Explorer
+	Handlers            []handler.Handler
+	ExplorerNames       []string
+	HandlerNames        []string
+	HandlerPolicies     []HandlerPolicy
+	HandlerDependencies [][]int
 
-	mu    sync.RWMutex
-	peers []*peer.Peer
+	CadenceOverride          explorer.Cadence
+	ExplorerCadenceOverrides []explorer.Cadence
+	Merge                    MergePolicy
+	Damping                  Damping
+	Store                    Store
+
+	// Exit is called when a handler whose failure policy is OnFailureExit
+	// failed. It is expected to shut peerd down.
+	Exit func(error)
+
+	mu      sync.RWMutex
+	peers   []*peer.Peer
+	state   map[*peer.Peer]*peerState
+	flaps   map[string]*flap
+	changed map[*peer.Peer]*peer.Peer
+	index   *peerIndex
+	nextSeq uint64
+
+	saved        []*peer.Peer
+	savedAt      time.Time
+	saveInterval time.Duration
+
+	statusMu       sync.Mutex
+	pending        map[handler.Handler][]delivery
+	degraded       map[handler.Handler]bool
+	calling        map[handler.Handler]chan struct{}
+	cadence        explorer.Cadence
+	lastCycle      *CycleStatus
+	explorerStatus []ComponentStatus
+	handlerStatus  []ComponentStatus
+	running        map[explorer.Explorer]*atomic.Bool
+	events         chan event
+}
+
+// peerState is the bookkeeping kept for every peer between cycles.
+type peerState struct {
+	sources map[string]*source
+	keys    map[string]bool
+	seen    bool
+	seq     uint64
+
+	seenCycles    int
+	missingCycles int
+	missingSince  time.Time
+	suppressed    bool
 }
 
 func (g *Group) Discovered(d *explorer.Discovery) {
+	g.discovered(source{}, d)
+}
+
+// discovered records the discovery as the latest report of the source.
+func (g *Group) discovered(src source, d *explorer.Discovery) {
+	dis := explorer.Discovery{
+		ID:        d.ID,
+		Name:      d.Name,
+		Labels:    copyLabels(d.Labels),
+		Addresses: copyAddresses(d.AllAddresses()),
+		Port:      d.Port,
+	}
+	key := sourceKey(src.name, &dis)
+	now := time.Now()
+
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
-	for _, p := range g.peers {
-		if p.IPv4Addr.Equal(d.IPv4Addr) && p.IPv6Addr.Equal(d.IPv6Addr) && p.Port == d.Port {
-			p.LastSeen = time.Now()
-			return
+	index := g.peerIndex()
+	p := g.findPeer(index, key, &dis)
+	if p == nil {
+		p = &peer.Peer{FirstSeen: now}
+		g.peers = append(g.peers, p)
+	}
+
+	if g.state == nil {
+		g.state = make(map[*peer.Peer]*peerState)
+	}
+
+	st := g.state[p]
+	if st == nil {
+		st = &peerState{
+			sources: make(map[string]*source),
+			keys:    make(map[string]bool),
+			seq:     g.nextSeq,
 		}
+		g.state[p] = st
+		g.nextSeq++
 	}
 
-	g.peers = append(g.peers, &peer.Peer{
-		IPv4Addr:  d.IPv4Addr,
-		IPv6Addr:  d.IPv6Addr,
-		Port:      d.Port,
-		FirstSeen: time.Now(),
-	})
+	index.remove(p, st)
+	previous := *p
+	src.discovery = dis
+	src.lastSeen = now
+	st.sources[key] = &src
+	st.keys[key] = true
+	st.seen = true
+	delete(st.sources, restoredSource)
+	index.add(p, st)
+	mergeSources(p, st.sources)
+
+	if !p.LastSeen.IsZero() {
+		if !sameAddress(&previous, p.Addresses, p.Port) {
+			g.trackChange(p, &previous)
+		}
+
+		p.LastSeen = now
+	}
 }
 
+// streamed tells whether a streaming explorer currently reports the peer.
+func (st *peerState) streamed() bool {
+	for _, s := range st.sources {
+		if s.streamer != nil && !s.removed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findPeer returns the peer holding the source or, failing that, the oldest
+// peer the discovery merges with.
+func (g *Group) findPeer(index *peerIndex, key string, d *explorer.Discovery) *peer.Peer {
+	if p := index.bySource(key); p != nil {
+		return p
+	}
+
+	var found *peer.Peer
+	for _, p := range index.matching(d) {
+		if found == nil || g.state[p].seq < g.state[found].seq {
+			found = p
+		}
+	}
+
+	return found
+}
+
+// expireSources drops the sources of a peer which have not reported it within
+// the TTL of their explorer, or peerTTL for sources without one. When all of
+// them expired the peer is left untouched and true is returned, so a missing
+// peer keeps its last known addresses.
+func (g *Group) expireSources(p *peer.Peer, st *peerState, peerTTL time.Duration, now time.Time) bool {
+	var expired []string
+	for key, s := range st.sources {
+		ttl := s.ttl
+		if ttl <= 0 {
+			ttl = peerTTL
+		}
+
+		if s.removed || (s.streamer == nil && s.lastSeen.Add(ttl).Before(now)) {
+			expired = append(expired, key)
+		}
+	}
+
+	if len(expired) == len(st.sources) {
+		return true
+	}
+
+	index := g.peerIndex()
+	index.remove(p, st)
+	for _, key := range expired {
+		if name := st.sources[key].name; name != "" {
+			log.Debugf("peer %v no longer seen by '%s'", p, name)
+		}
+		delete(st.sources, key)
+	}
+	index.add(p, st)
+
+	if len(expired) > 0 {
+		previous := *p
+		mergeSources(p, st.sources)
+		if !p.LastSeen.IsZero() && !sameAddress(&previous, p.Addresses, p.Port) {
+			g.trackChange(p, &previous)
+		}
+	}
+
+	return false
+}
+
+func (g *Group) trackChange(p *peer.Peer, previous *peer.Peer) {
+	if g.changed == nil {
+		g.changed = make(map[*peer.Peer]*peer.Peer)
+	}
+
+	if _, ok := g.changed[p]; !ok {
+		g.changed[p] = previous
+	}
+}
+
+// GetPeers returns the peers which have been announced to the handlers.
 func (g *Group) GetPeers() []*peer.Peer {
 	g.mu.RLock()
 	defer g.mu.RUnlock()
 
-	return copyPeers(g.peers)
+	return copyPeers(announcedPeers(g.peers))
 }
 
 func (g *Group) Reconcile(ctx context.Context, peerTTL time.Duration) ([]*peer.Peer, []*peer.Peer, []*peer.Peer) {
+	return g.reconcile(ctx, peerTTL, nil)
+}
+
+// reconcile settles the membership of the peers. A peer only known to idle
+// sources, explorers which did not run this cycle, is neither counted as seen
+// nor as missing.
+func (g *Group) reconcile(ctx context.Context, peerTTL time.Duration, idle map[string]bool) ([]*peer.Peer, []*peer.Peer, []*peer.Peer) {
 	if peerTTL <= 0 {
 		peerTTL = 5 * time.Second
 	}
@@ -60,42 +237,207 @@ func (g *Group) Reconcile(ctx context.Context, peerTTL time.Duration) ([]*peer.P
 	var newPeers []*peer.Peer
 	var lostPeers []*peer.Peer
 
+	g.forgetFlaps(now)
+
 	for _, p := range g.peers {
+		st := g.state[p]
+		if idleSources(st, idle) {
+			tmp = append(tmp, p)
+			continue
+		}
+
+		seen := st.seen || st.streamed()
+		st.seen = false
+		missing := g.expireSources(p, st, peerTTL, now)
+
 		if p.LastSeen.IsZero() {
+			if !seen {
+				st.seenCycles = 0
+				if missing {
+					log.Debugf("pending peer %v disappeared before it was announced", p)
+					g.peerIndex().remove(p, st)
+					delete(g.state, p)
+					delete(g.changed, p)
+					continue
+				}
+			} else {
+				st.seenCycles++
+			}
+
+			st.suppressed = g.suppressed(p, st, now)
+			if st.suppressed || !g.Damping.announce(st) {
+				log.Debugf("peer %v seen in %d/%d cycle(s), suppressed=%t, not announcing yet", p, st.seenCycles, max(g.Damping.UpCycles, 1), st.suppressed)
+				tmp = append(tmp, p)
+				continue
+			}
+
 			log.Debugf("new peer %v", p)
 			newPeers = append(newPeers, p)
 			p.LastSeen = now
+			tmp = append(tmp, p)
+			continue
+		}
+
+		if !missing {
+			if st.missingCycles > 0 {
+				log.Infof("Peer %v of group '%s' is back after %d missed cycle(s)", p, g.Name, st.missingCycles)
+			}
+
+			st.missingCycles = 0
+			st.missingSince = time.Time{}
+			tmp = append(tmp, p)
+			continue
+		}
+
+		st.missingCycles++
+		if st.missingSince.IsZero() {
+			st.missingSince = now
 		}
 
-		if p.LastSeen.Add(peerTTL).Before(now) {
+		if g.Damping.lost(st, now) {
 			log.Debugf("lost peer %v", p)
 			lostPeers = append(lostPeers, p)
+			g.penalize(p, st, now)
+			g.peerIndex().remove(p, st)
+			delete(g.state, p)
+			delete(g.changed, p)
 		} else {
+			log.Infof("Peer %v of group '%s' missing for %d cycle(s) since %s, not declaring it lost yet", p, g.Name, st.missingCycles, st.missingSince.Format(time.RFC3339))
 			tmp = append(tmp, p)
 		}
 	}
 
 	g.peers = tmp
-	peers := copyPeers(g.peers)
+	peers := copyPeers(announcedPeers(g.peers))
+
+	var changedPeers [][2]*peer.Peer
+	for _, p := range g.peers {
+		if previous, ok := g.changed[p]; ok && !sameAddress(previous, p.Addresses, p.Port) {
+			log.Debugf("peer %v changed address from %v", p, previous)
+			current := *p
+			changedPeers = append(changedPeers, [2]*peer.Peer{previous, &current})
+		}
+	}
+	g.changed = nil
 	g.mu.Unlock()
 
+	newPeers, lostPeers = copyPeers(newPeers), copyPeers(lostPeers)
+
+	var deliveries []delivery
 	for _, p := range newPeers {
-		for _, h := range g.Handlers {
-			if err := h.NewPeer(ctx, p); err != nil {
-				log.Warnf("Failed running new-peer hook for group '%s' of handler '%s': %v", g.Name, reflect.TypeOf(h).String(), err)
+		deliveries = append(deliveries, delivery{hook: HookNewPeer, peer: p})
+	}
+	for _, p := range lostPeers {
+		deliveries = append(deliveries, delivery{hook: HookLostPeer, peer: p})
+	}
+
+	g.runHandlers("new-peer/lost-peer", func(idx int) error {
+		return g.deliver(ctx, idx, deliveries)
+	}, func(idx int) {
+		g.postpone(idx, deliveries)
+	})
+
+	if len(changedPeers) > 0 {
+		g.runHandlers(HookAddressChanged, func(idx int) error {
+			changeHandler, ok := g.Handlers[idx].(handler.AddressChangeHandler)
+			if !ok {
+				return nil
+			}
+
+			var failed error
+			for _, change := range changedPeers {
+				if err := g.callHandler(ctx, idx, HookAddressChanged, func(ctx context.Context) error { return changeHandler.PeerAddressChanged(ctx, change[0], change[1]) }); err != nil {
+					log.Warnf("Failed running address-change hook for group '%s' of handler '%s': %v", g.Name, g.handlerName(idx), err)
+					failed = err
+				}
 			}
+			return failed
+		}, nil)
+	}
+
+	return peers, newPeers, lostPeers
+}
+
+func (g *Group) Shutdown(ctx context.Context) {
+	g.shutdown(ctx, func(int) bool { return true })
+}
+
+// ShutdownHandlers runs the shutdown hook of the handlers only, which are about
+// to be removed from the group. The group must not be running.
+func (g *Group) ShutdownHandlers(ctx context.Context, handlers []handler.Handler) {
+	removed := make(map[handler.Handler]bool, len(handlers))
+	for _, h := range handlers {
+		removed[h] = true
+	}
+
+	g.shutdown(ctx, func(idx int) bool { return removed[g.Handlers[idx]] })
+}
+
+func (g *Group) shutdown(ctx context.Context, selected func(int) bool) {
+	peers := g.GetPeers()
+
+	g.runHandlers(HookShutdown, func(idx int) error {
+		shutdowner, ok := g.Handlers[idx].(handler.Shutdowner)
+		if !ok || !selected(idx) {
+			return nil
 		}
+
+		err := g.callHandler(ctx, idx, HookShutdown, func(ctx context.Context) error { return shutdowner.Shutdown(ctx, peers) })
+		if err != nil {
+			log.Warnf("Failed running shutdown hook for group '%s' of handler '%s': %v", g.Name, g.handlerName(idx), err)
+		}
+		return err
+	}, nil)
+}
+
+func idleSources(st *peerState, idle map[string]bool) bool {
+	if len(idle) == 0 {
+		return false
 	}
 
-	for _, p := range lostPeers {
-		for _, h := range g.Handlers {
-			if err := h.LostPeer(ctx, p); err != nil {
-				log.Warnf("Failed running lost-peer hook for group '%s' of handler '%s': %v", g.Name, reflect.TypeOf(h).String(), err)
-			}
+	for _, s := range st.sources {
+		if !idle[s.name] {
+			return false
 		}
 	}
 
-	return peers, copyPeers(newPeers), copyPeers(lostPeers)
+	return true
+}
+
+func announcedPeers(peers []*peer.Peer) []*peer.Peer {
+	var tmp []*peer.Peer
+	for _, p := range peers {
+		if !p.LastSeen.IsZero() {
+			tmp = append(tmp, p)
+		}
+	}
+	return tmp
+}
+
+func sameAddress(p *peer.Peer, addresses []peer.Address, port uint16) bool {
+	return peer.SameAddresses(p.Addresses, addresses) && p.Port == port
+}
+
+func copyAddresses(addresses []peer.Address) []peer.Address {
+	if addresses == nil {
+		return nil
+	}
+
+	tmp := make([]peer.Address, len(addresses))
+	copy(tmp, addresses)
+	return tmp
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	if labels == nil {
+		return nil
+	}
+
+	tmp := make(map[string]string, len(labels))
+	for k, v := range labels {
+		tmp[k] = v
+	}
+	return tmp
 }
 
 func copyPeers(peers []*peer.Peer) []*peer.Peer {
@@ -2,13 +2,39 @@ package group
 
 import (
 	"context"
+	"errors"
 	"net"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/ravenix/peerd/internal/peer"
 	"github.com/ravenix/peerd/pkg/explorer"
+	"github.com/ravenix/peerd/pkg/handler"
 )
 
+type testHandler struct {
+	shutdownPeers []*peer.Peer
+	changedPeers  [][2]*peer.Peer
+}
+
+func (h *testHandler) PreExploration(context.Context, []*peer.Peer) error { return nil }
+func (h *testHandler) NewPeer(context.Context, *peer.Peer) error          { return nil }
+func (h *testHandler) LostPeer(context.Context, *peer.Peer) error         { return nil }
+func (h *testHandler) PostExploration(context.Context, []*peer.Peer, []*peer.Peer, []*peer.Peer) error {
+	return nil
+}
+
+func (h *testHandler) PeerAddressChanged(ctx context.Context, previous *peer.Peer, current *peer.Peer) error {
+	h.changedPeers = append(h.changedPeers, [2]*peer.Peer{previous, current})
+	return nil
+}
+
+func (h *testHandler) Shutdown(ctx context.Context, peers []*peer.Peer) error {
+	h.shutdownPeers = peers
+	return nil
+}
+
 func TestReconcileRespectsPeerTTL(t *testing.T) {
 	g := &Group{Name: "test"}
 	g.Discovered(&explorer.Discovery{
@@ -47,3 +73,922 @@ func TestReconcileUsesDefaultTTLWhenUnset(t *testing.T) {
 		t.Fatalf("expected no lost peers with default ttl, got %d", len(lostPeers))
 	}
 }
+
+func TestShutdownPassesCurrentPeersToHandlers(t *testing.T) {
+	h := &testHandler{}
+	g := &Group{Name: "test", Handlers: []handler.Handler{h}}
+	g.Discovered(&explorer.Discovery{
+		IPv6Addr: net.ParseIP("fd00::3"),
+		Port:     179,
+	})
+	_, _, _ = g.Reconcile(context.Background(), time.Second)
+
+	g.Shutdown(context.Background())
+	if len(h.shutdownPeers) != 1 {
+		t.Fatalf("expected one peer on shutdown, got %d", len(h.shutdownPeers))
+	}
+
+	if !h.shutdownPeers[0].IPv6Addr.Equal(net.ParseIP("fd00::3")) {
+		t.Fatalf("unexpected shutdown peer: %v", h.shutdownPeers[0])
+	}
+}
+
+type testExplorer struct {
+	err error
+}
+
+func (e *testExplorer) Run(context.Context) error { return nil }
+
+func (e *testExplorer) Explore(ctx context.Context, dh explorer.DiscoveryHandler) error {
+	dh.Discovered(&explorer.Discovery{
+		IPv6Addr: net.ParseIP("fd00::4"),
+		Port:     179,
+	})
+	return e.err
+}
+
+func TestRunCycleRecordsStatus(t *testing.T) {
+	expectedErr := errors.New("explore failed")
+	g := &Group{
+		Name:          "test",
+		Explorers:     []explorer.Explorer{&testExplorer{err: expectedErr}},
+		ExplorerNames: []string{"test:explorer"},
+		Handlers:      []handler.Handler{&testHandler{}},
+	}
+
+	cadence := explorer.Cadence{
+		ExploreInterval: time.Second,
+		ExploreTimeout:  10 * time.Millisecond,
+		PeerTTL:         time.Second,
+	}
+	g.resetStatus(cadence)
+	g.runCycle(context.Background(), []int{0})
+
+	s := g.Status()
+	if s.Cadence != cadence {
+		t.Fatalf("unexpected cadence: %v", s.Cadence)
+	}
+
+	if len(s.Peers) != 1 || s.LastCycle == nil || len(s.LastCycle.NewPeers) != 1 {
+		t.Fatalf("expected one new peer in the last cycle, got %+v", s.LastCycle)
+	}
+
+	if s.Explorers[0].Name != "test:explorer" || s.Explorers[0].Calls[HookExplore].Error != expectedErr.Error() {
+		t.Fatalf("unexpected explorer status: %+v", s.Explorers[0])
+	}
+
+	if _, ok := s.Handlers[0].Calls[HookPostExploration]; !ok {
+		t.Fatalf("expected post-exploration hook to be recorded: %+v", s.Handlers[0])
+	}
+}
+
+func TestHandlersSharingANameAreReportedApart(t *testing.T) {
+	g := &Group{
+		Name:         "test",
+		Handlers:     []handler.Handler{&testHandler{}, &testHandler{}, &testHandler{}},
+		HandlerNames: []string{"test:handler", "test:handler", "reload"},
+	}
+	g.resetStatus(explorer.Cadence{})
+
+	s := g.Status()
+	for idx, name := range []string{"test:handler#0", "test:handler#1", "reload"} {
+		if s.Handlers[idx].Name != name {
+			t.Fatalf("expected handler %d to be reported as '%s', got '%s'", idx, name, s.Handlers[idx].Name)
+		}
+	}
+}
+
+func TestDiscoveredMatchesOnIDAndReportsAddressChange(t *testing.T) {
+	h := &testHandler{}
+	g := &Group{Name: "test", Handlers: []handler.Handler{h}}
+	g.Discovered(&explorer.Discovery{
+		ID:       "pod/default/a",
+		Name:     "a",
+		IPv4Addr: net.ParseIP("10.0.0.1"),
+		Port:     179,
+	})
+
+	_, newPeers, _ := g.Reconcile(context.Background(), time.Second)
+	if len(newPeers) != 1 {
+		t.Fatalf("expected one new peer, got %d", len(newPeers))
+	}
+
+	g.Discovered(&explorer.Discovery{
+		ID:       "pod/default/a",
+		Name:     "a",
+		Labels:   map[string]string{"app": "router"},
+		IPv4Addr: net.ParseIP("10.0.0.2"),
+		Port:     179,
+	})
+
+	peers, newPeers, lostPeers := g.Reconcile(context.Background(), time.Second)
+	if len(peers) != 1 || len(newPeers) != 0 || len(lostPeers) != 0 {
+		t.Fatalf("expected address change not to be reported as new or lost peer, got %d/%d/%d", len(peers), len(newPeers), len(lostPeers))
+	}
+
+	if !peers[0].IPv4Addr.Equal(net.ParseIP("10.0.0.2")) || peers[0].Labels["app"] != "router" {
+		t.Fatalf("unexpected peer after address change: %+v", peers[0])
+	}
+
+	if len(h.changedPeers) != 1 {
+		t.Fatalf("expected one address change, got %d", len(h.changedPeers))
+	}
+
+	if !h.changedPeers[0][0].IPv4Addr.Equal(net.ParseIP("10.0.0.1")) || !h.changedPeers[0][1].IPv4Addr.Equal(net.ParseIP("10.0.0.2")) {
+		t.Fatalf("unexpected address change: %v -> %v", h.changedPeers[0][0], h.changedPeers[0][1])
+	}
+}
+
+func TestDiscoveredTwiceBeforeReconcileIsStillNew(t *testing.T) {
+	g := &Group{Name: "test"}
+	for i := 0; i < 2; i++ {
+		g.Discovered(&explorer.Discovery{
+			IPv6Addr: net.ParseIP("fd00::5"),
+			Port:     179,
+		})
+	}
+
+	_, newPeers, _ := g.Reconcile(context.Background(), time.Second)
+	if len(newPeers) != 1 {
+		t.Fatalf("expected one new peer, got %d", len(newPeers))
+	}
+}
+
+func TestDiscoveredMergesSourcesOnSharedAddress(t *testing.T) {
+	g := &Group{Name: "test", Merge: MergePolicy{Match: MatchAddress}}
+	(&sourceHandler{group: g, source: "multicast:dns"}).Discovered(&explorer.Discovery{
+		ID:       "router-a._bgp._tcp.local.",
+		Name:     "router-a",
+		IPv4Addr: net.ParseIP("10.0.0.1"),
+		IPv6Addr: net.ParseIP("fd00::1"),
+		Port:     179,
+	})
+	(&sourceHandler{group: g, source: "kubernetes:node"}).Discovered(&explorer.Discovery{
+		ID:       "node/router-a",
+		Name:     "router-a",
+		Labels:   map[string]string{"kubernetes.node_name": "router-a"},
+		IPv4Addr: net.ParseIP("10.0.0.1"),
+	})
+
+	peers, newPeers, _ := g.Reconcile(context.Background(), time.Second)
+	if len(peers) != 1 || len(newPeers) != 1 {
+		t.Fatalf("expected discoveries to be merged into one new peer, got %d/%d", len(peers), len(newPeers))
+	}
+
+	p := peers[0]
+	if len(p.Addresses) != 2 || p.Port != 179 || p.Labels["kubernetes.node_name"] != "router-a" {
+		t.Fatalf("unexpected merged peer: %+v", p)
+	}
+
+	if len(p.Sources) != 2 || p.Sources[0] != "kubernetes:node" || p.Sources[1] != "multicast:dns" {
+		t.Fatalf("unexpected sources: %v", p.Sources)
+	}
+}
+
+func TestDiscoveredFollowsChangedMergePolicy(t *testing.T) {
+	g := &Group{Name: "test"}
+	for _, id := range []string{"router-a", "router-b"} {
+		g.Discovered(&explorer.Discovery{ID: id, Labels: map[string]string{"site": "ams"}, IPv4Addr: net.ParseIP("10.0.0.1")})
+	}
+
+	if peers, _, _ := g.Reconcile(context.Background(), time.Second); len(peers) != 2 {
+		t.Fatalf("expected discoveries with different IDs to be kept apart, got %d peer(s)", len(peers))
+	}
+
+	g.Merge = MergePolicy{Match: MatchLabel, Label: "site"}
+	(&sourceHandler{group: g, source: "kubernetes:node"}).Discovered(&explorer.Discovery{
+		ID:       "node/router-c",
+		Labels:   map[string]string{"site": "ams"},
+		IPv4Addr: net.ParseIP("10.0.0.3"),
+	})
+
+	peers, _, _ := g.Reconcile(context.Background(), time.Second)
+	if len(peers) != 2 {
+		t.Fatalf("expected discovery to be merged by label, got %d peer(s)", len(peers))
+	}
+
+	if peers[0].ID != "router-a" || len(peers[0].Sources) != 1 || peers[0].Sources[0] != "kubernetes:node" {
+		t.Fatalf("expected discovery to be merged into the oldest matching peer, got %+v", peers[0])
+	}
+}
+
+func TestMergedPeerIsLostWhenAllSourcesExpire(t *testing.T) {
+	h := &testHandler{}
+	g := &Group{
+		Name:     "test",
+		Handlers: []handler.Handler{h},
+		Merge:    MergePolicy{Match: MatchLabel, Label: "host"},
+	}
+	dns := &sourceHandler{group: g, source: "multicast:dns"}
+	node := &sourceHandler{group: g, source: "kubernetes:node"}
+
+	dns.Discovered(&explorer.Discovery{
+		Labels:   map[string]string{"host": "a"},
+		IPv4Addr: net.ParseIP("10.0.0.1"),
+	})
+	node.Discovered(&explorer.Discovery{
+		ID:       "node/a",
+		Labels:   map[string]string{"host": "a"},
+		IPv6Addr: net.ParseIP("fd00::1"),
+	})
+
+	if _, newPeers, _ := g.Reconcile(context.Background(), time.Second); len(newPeers) != 1 {
+		t.Fatalf("expected one new peer, got %d", len(newPeers))
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	node.Discovered(&explorer.Discovery{
+		ID:       "node/a",
+		Labels:   map[string]string{"host": "a"},
+		IPv6Addr: net.ParseIP("fd00::1"),
+	})
+
+	peers, _, lostPeers := g.Reconcile(context.Background(), 10*time.Millisecond)
+	if len(peers) != 1 || len(lostPeers) != 0 {
+		t.Fatalf("expected peer to survive while one source still sees it, got %d/%d", len(peers), len(lostPeers))
+	}
+
+	if len(peers[0].Addresses) != 1 || !peers[0].Addresses[0].IP.Equal(net.ParseIP("fd00::1")) {
+		t.Fatalf("expected addresses of the expired source to be dropped: %v", peers[0].Addresses)
+	}
+
+	if len(h.changedPeers) != 1 {
+		t.Fatalf("expected one address change, got %d", len(h.changedPeers))
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if _, _, lostPeers := g.Reconcile(context.Background(), 10*time.Millisecond); len(lostPeers) != 1 {
+		t.Fatalf("expected peer to be lost once all sources expired, got %d", len(lostPeers))
+	}
+}
+
+func TestNewMergePolicy(t *testing.T) {
+	if m, err := NewMergePolicy("", ""); err != nil || m.Match != MatchID {
+		t.Fatalf("expected default policy to match on ID, got %+v, %v", m, err)
+	}
+
+	for _, tc := range []struct{ match, label string }{
+		{"label", ""},
+		{"address", "host"},
+		{"hostname", ""},
+	} {
+		if _, err := NewMergePolicy(tc.match, tc.label); err == nil {
+			t.Fatalf("expected error for match '%s' label '%s'", tc.match, tc.label)
+		}
+	}
+}
+
+func TestDampingAnnouncesAfterConsecutiveCycles(t *testing.T) {
+	g := &Group{Name: "test", Damping: Damping{UpCycles: 2}}
+	discover := func() {
+		g.Discovered(&explorer.Discovery{
+			IPv4Addr: net.ParseIP("10.0.0.1"),
+			Port:     179,
+		})
+	}
+
+	discover()
+	peers, newPeers, _ := g.Reconcile(context.Background(), time.Second)
+	if len(peers) != 0 || len(newPeers) != 0 {
+		t.Fatalf("expected peer to be held back after one cycle, got %d/%d", len(peers), len(newPeers))
+	}
+
+	if d := g.DampingStatus(); len(d) != 1 || d[0].State != DampingPending || d[0].Cycles != 1 {
+		t.Fatalf("unexpected damping status: %+v", d)
+	}
+
+	// Not seen in this cycle, the count starts over.
+	_, newPeers, _ = g.Reconcile(context.Background(), time.Second)
+	if len(newPeers) != 0 {
+		t.Fatalf("expected peer to be held back after a missed cycle")
+	}
+
+	discover()
+	_, newPeers, _ = g.Reconcile(context.Background(), time.Second)
+	if len(newPeers) != 0 {
+		t.Fatalf("expected consecutive count to restart after a missed cycle")
+	}
+
+	discover()
+	peers, newPeers, _ = g.Reconcile(context.Background(), time.Second)
+	if len(peers) != 1 || len(newPeers) != 1 {
+		t.Fatalf("expected peer to be announced after two consecutive cycles, got %d/%d", len(peers), len(newPeers))
+	}
+}
+
+func TestDampingKeepsMissingPeerForDownCycles(t *testing.T) {
+	g := &Group{Name: "test", Damping: Damping{DownCycles: 2}}
+	g.Discovered(&explorer.Discovery{
+		IPv4Addr: net.ParseIP("10.0.0.1"),
+		Port:     179,
+	})
+	_, _, _ = g.Reconcile(context.Background(), time.Millisecond)
+
+	time.Sleep(5 * time.Millisecond)
+	peers, _, lostPeers := g.Reconcile(context.Background(), time.Millisecond)
+	if len(peers) != 1 || len(lostPeers) != 0 {
+		t.Fatalf("expected peer to be kept after one missed cycle, got %d/%d", len(peers), len(lostPeers))
+	}
+
+	if d := g.DampingStatus(); len(d) != 1 || d[0].State != DampingMissing || d[0].Since.IsZero() {
+		t.Fatalf("unexpected damping status: %+v", d)
+	}
+
+	_, _, lostPeers = g.Reconcile(context.Background(), time.Millisecond)
+	if len(lostPeers) != 1 {
+		t.Fatalf("expected peer to be lost after two missed cycles, got %d", len(lostPeers))
+	}
+}
+
+func TestDampingSuppressesFlappingPeer(t *testing.T) {
+	g := &Group{
+		Name: "test",
+		Damping: Damping{
+			FlapPenalty:       1000,
+			HalfLife:          50 * time.Millisecond,
+			SuppressThreshold: 1500,
+			ReuseThreshold:    500,
+		},
+	}
+	flap := func() (int, int) {
+		g.Discovered(&explorer.Discovery{
+			ID:       "a",
+			IPv4Addr: net.ParseIP("10.0.0.1"),
+		})
+		_, newPeers, _ := g.Reconcile(context.Background(), time.Millisecond)
+		time.Sleep(2 * time.Millisecond)
+		_, _, lostPeers := g.Reconcile(context.Background(), time.Millisecond)
+		return len(newPeers), len(lostPeers)
+	}
+
+	for i := 0; i < 2; i++ {
+		if newPeers, lostPeers := flap(); newPeers != 1 || lostPeers != 1 {
+			t.Fatalf("expected flap %d to be reported, got %d/%d", i, newPeers, lostPeers)
+		}
+	}
+
+	g.Discovered(&explorer.Discovery{
+		ID:       "a",
+		IPv4Addr: net.ParseIP("10.0.0.1"),
+	})
+	if _, newPeers, _ := g.Reconcile(context.Background(), time.Second); len(newPeers) != 0 {
+		t.Fatalf("expected flapping peer to be suppressed")
+	}
+
+	if d := g.DampingStatus(); len(d) != 1 || d[0].State != DampingSuppressed || d[0].Penalty < 1500 {
+		t.Fatalf("unexpected damping status: %+v", d)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	g.Discovered(&explorer.Discovery{
+		ID:       "a",
+		IPv4Addr: net.ParseIP("10.0.0.1"),
+	})
+	if _, newPeers, _ := g.Reconcile(context.Background(), time.Second); len(newPeers) != 1 {
+		t.Fatalf("expected peer to be announced once the penalty decayed")
+	}
+}
+
+func TestDampingValidate(t *testing.T) {
+	for _, d := range []Damping{
+		{UpCycles: -1},
+		{HalfLife: time.Minute},
+		{FlapPenalty: 1000, SuppressThreshold: 2000, ReuseThreshold: 750},
+		{FlapPenalty: 1000, HalfLife: time.Minute, SuppressThreshold: 750, ReuseThreshold: 2000},
+	} {
+		if err := d.Validate(); err == nil {
+			t.Fatalf("expected error for %+v", d)
+		}
+	}
+
+	if err := (Damping{FlapPenalty: 1000, HalfLife: time.Minute, SuppressThreshold: 2000, ReuseThreshold: 750}).Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+type testStore struct {
+	peers map[string][]*peer.Peer
+}
+
+func (s *testStore) Load(group string) ([]*peer.Peer, error) {
+	return s.peers[group], nil
+}
+
+func (s *testStore) Save(group string, peers []*peer.Peer) error {
+	s.peers[group] = peers
+	return nil
+}
+
+func TestRestoredPeersAreKeptDuringGracePeriod(t *testing.T) {
+	lastSeen := time.Now().Add(-time.Minute)
+	store := &testStore{peers: map[string][]*peer.Peer{
+		"test": {
+			{ID: "a", Addresses: []peer.Address{peer.NewAddress(net.ParseIP("10.0.0.1"))}, FirstSeen: lastSeen, LastSeen: lastSeen},
+			{ID: "b", Addresses: []peer.Address{peer.NewAddress(net.ParseIP("10.0.0.2"))}, FirstSeen: lastSeen, LastSeen: lastSeen},
+		},
+	}}
+
+	h := &testHandler{}
+	g := &Group{Name: "test", Handlers: []handler.Handler{h}, Store: store}
+	if err := g.Restore(20 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	if peers := g.GetPeers(); len(peers) != 2 {
+		t.Fatalf("expected restored peers before the first cycle, got %d", len(peers))
+	}
+
+	g.Discovered(&explorer.Discovery{ID: "a", IPv4Addr: net.ParseIP("10.0.0.3")})
+	peers, newPeers, lostPeers := g.Reconcile(context.Background(), time.Millisecond)
+	if len(peers) != 2 || len(newPeers) != 0 || len(lostPeers) != 0 {
+		t.Fatalf("expected restored peers to be kept without changes, got %d/%d/%d", len(peers), len(newPeers), len(lostPeers))
+	}
+
+	if len(h.changedPeers) != 1 || !h.changedPeers[0][1].Addresses[0].IP.Equal(net.ParseIP("10.0.0.3")) {
+		t.Fatalf("expected confirmed peer to replace its restored address: %v", h.changedPeers)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	g.Discovered(&explorer.Discovery{ID: "a", IPv4Addr: net.ParseIP("10.0.0.3")})
+	_, _, lostPeers = g.Reconcile(context.Background(), time.Millisecond)
+	if len(lostPeers) != 1 || lostPeers[0].ID != "b" {
+		t.Fatalf("expected unconfirmed peer to be lost after the grace period, got %v", lostPeers)
+	}
+}
+
+func TestRunCycleSavesState(t *testing.T) {
+	store := &testStore{peers: make(map[string][]*peer.Peer)}
+	g := &Group{
+		Name:      "test",
+		Explorers: []explorer.Explorer{&testExplorer{}},
+		Store:     store,
+	}
+
+	cadence := explorer.Cadence{
+		ExploreInterval: time.Second,
+		ExploreTimeout:  10 * time.Millisecond,
+		PeerTTL:         time.Second,
+	}
+	g.resetStatus(cadence)
+	g.runCycle(context.Background(), []int{0})
+
+	if peers := store.peers["test"]; len(peers) != 1 || peers[0].LastSeen.IsZero() {
+		t.Fatalf("expected announced peer to be saved, got %v", peers)
+	}
+}
+
+type failingHandler struct {
+	testHandler
+	failures int
+	block    bool
+	newPeers []*peer.Peer
+	calls    atomic.Int32
+}
+
+func (h *failingHandler) NewPeer(ctx context.Context, p *peer.Peer) error {
+	h.calls.Add(1)
+	if h.block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	if h.failures > 0 {
+		h.failures--
+		return errors.New("not now")
+	}
+
+	h.newPeers = append(h.newPeers, p)
+	return nil
+}
+
+func TestCallHandlerRetriesWithTimeout(t *testing.T) {
+	h := &failingHandler{block: true}
+	g := &Group{
+		Name:            "test",
+		Handlers:        []handler.Handler{h},
+		HandlerPolicies: []HandlerPolicy{{Timeout: 5 * time.Millisecond, Retries: 2, Backoff: time.Millisecond}},
+	}
+	g.resetStatus(explorer.Cadence{})
+
+	err := g.callHandler(context.Background(), 0, HookNewPeer, func(ctx context.Context) error { return h.NewPeer(ctx, &peer.Peer{}) })
+	if err == nil || h.calls.Load() != 3 {
+		t.Fatalf("expected three timed out attempts, got %d: %v", h.calls.Load(), err)
+	}
+}
+
+// hangingHandler ignores the deadline of its calls until it is released.
+type hangingHandler struct {
+	testHandler
+	release chan struct{}
+	calls   atomic.Int32
+	running atomic.Int32
+	overlap atomic.Bool
+}
+
+func (h *hangingHandler) NewPeer(ctx context.Context, p *peer.Peer) error {
+	h.calls.Add(1)
+	if h.running.Add(1) > 1 {
+		h.overlap.Store(true)
+	}
+	defer h.running.Add(-1)
+
+	<-h.release
+	return nil
+}
+
+func TestCallHandlerDoesNotOverlapAbandonedCalls(t *testing.T) {
+	h := &hangingHandler{release: make(chan struct{})}
+	g := &Group{
+		Name:            "test",
+		Handlers:        []handler.Handler{h},
+		HandlerPolicies: []HandlerPolicy{{Timeout: 20 * time.Millisecond, Retries: 2, Backoff: time.Millisecond}},
+	}
+	g.resetStatus(explorer.Cadence{})
+
+	call := func(ctx context.Context) error { return h.NewPeer(ctx, &peer.Peer{}) }
+	if err := g.callHandler(context.Background(), 0, HookNewPeer, call); err == nil {
+		t.Fatalf("expected hanging call to fail")
+	}
+
+	if err := g.callHandler(context.Background(), 0, HookNewPeer, call); !errors.Is(err, errHookRunning) {
+		t.Fatalf("expected handler to be skipped while its call hangs, got %v", err)
+	}
+
+	if h.calls.Load() != 1 {
+		t.Fatalf("expected a single call while the first one hangs, got %d", h.calls.Load())
+	}
+
+	close(h.release)
+	if err := g.callHandler(context.Background(), 0, HookNewPeer, call); err != nil {
+		t.Fatalf("expected handler to be called again once released, got %v", err)
+	}
+
+	if h.overlap.Load() {
+		t.Fatalf("expected calls of the handler not to overlap")
+	}
+}
+
+func TestHandlerPolicyBackoffIsBounded(t *testing.T) {
+	p := HandlerPolicy{Retries: maxRetries, Backoff: time.Second}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for attempt, expected := range map[int]time.Duration{0: time.Second, 1: 2 * time.Second, 5: 32 * time.Second, 6: time.Minute, 64: time.Minute} {
+		if delay := p.backoff(attempt); delay != expected {
+			t.Errorf("expected backoff %s after attempt %d, got %s", expected, attempt, delay)
+		}
+	}
+
+	if delay := (HandlerPolicy{Backoff: time.Hour}).backoff(3); delay != time.Hour {
+		t.Errorf("expected a backoff above the limit to be kept, got %s", delay)
+	}
+
+	if err := (HandlerPolicy{Retries: maxRetries + 1}).Validate(); err == nil {
+		t.Errorf("expected too many retries to be rejected")
+	}
+}
+
+func TestFailingExitHandlerAsksToExit(t *testing.T) {
+	var exitErr error
+	h := &failingHandler{failures: 1}
+	g := &Group{
+		Name:            "test",
+		Handlers:        []handler.Handler{h},
+		HandlerPolicies: []HandlerPolicy{{OnFailure: OnFailureExit}},
+		Exit:            func(err error) { exitErr = err },
+	}
+	g.resetStatus(explorer.Cadence{})
+
+	g.Discovered(&explorer.Discovery{ID: "a", IPv4Addr: net.ParseIP("10.0.0.1")})
+	_, _, _ = g.Reconcile(context.Background(), time.Second)
+
+	if exitErr == nil {
+		t.Fatalf("expected failing handler to ask for an exit")
+	}
+}
+
+func TestFailedNewPeerIsDeliveredAgain(t *testing.T) {
+	h := &failingHandler{failures: 1}
+	g := &Group{
+		Name:            "test",
+		Handlers:        []handler.Handler{h},
+		HandlerPolicies: []HandlerPolicy{{OnFailure: OnFailureDegrade}},
+	}
+	g.resetStatus(explorer.Cadence{})
+
+	g.Discovered(&explorer.Discovery{ID: "a", IPv4Addr: net.ParseIP("10.0.0.1")})
+	_, _, _ = g.Reconcile(context.Background(), time.Second)
+
+	if s := g.Status(); !s.Degraded || s.Handlers[0].Pending != 1 {
+		t.Fatalf("expected degraded group with one pending delivery: %+v", s)
+	}
+
+	g.Discovered(&explorer.Discovery{ID: "a", IPv4Addr: net.ParseIP("10.0.0.1")})
+	_, _, _ = g.Reconcile(context.Background(), time.Second)
+
+	if len(h.newPeers) != 1 || h.newPeers[0].ID != "a" {
+		t.Fatalf("expected new peer to be delivered again, got %v", h.newPeers)
+	}
+
+	if s := g.Status(); s.Degraded || s.Handlers[0].Pending != 0 {
+		t.Fatalf("expected group to recover: %+v", s)
+	}
+}
+
+func TestCompactDeliveriesDropsUnseenPeers(t *testing.T) {
+	firstSeen := time.Now()
+	a := &peer.Peer{ID: "a", FirstSeen: firstSeen}
+	b := &peer.Peer{ID: "b", FirstSeen: firstSeen}
+
+	queue := compactDeliveries([]delivery{
+		{hook: HookNewPeer, peer: a},
+		{hook: HookLostPeer, peer: b},
+		{hook: HookLostPeer, peer: a},
+		{hook: HookNewPeer, peer: b},
+	})
+
+	if len(queue) != 2 || queue[0].peer != b || queue[0].hook != HookLostPeer || queue[1].hook != HookNewPeer {
+		t.Fatalf("unexpected deliveries: %+v", queue)
+	}
+}
+
+type cadenceExplorer struct {
+	testExplorer
+	cadence explorer.Cadence
+}
+
+func (e *cadenceExplorer) Cadence() explorer.Cadence { return e.cadence }
+
+func TestResolveCadenceAppliesOverrides(t *testing.T) {
+	g := &Group{
+		Name: "test",
+		Explorers: []explorer.Explorer{
+			&cadenceExplorer{cadence: explorer.Cadence{ExploreInterval: 100 * time.Millisecond, ExploreTimeout: 80 * time.Millisecond, PeerTTL: 300 * time.Millisecond}},
+			&cadenceExplorer{cadence: explorer.Cadence{ExploreInterval: 2 * time.Second, ExploreTimeout: 1500 * time.Millisecond, PeerTTL: 6 * time.Second}},
+		},
+		ExplorerCadenceOverrides: []explorer.Cadence{
+			{ExploreInterval: time.Second},
+			{ExploreTimeout: 500 * time.Millisecond},
+		},
+		CadenceOverride: explorer.Cadence{PeerTTL: 10 * time.Second},
+	}
+
+	expected := explorer.Cadence{
+		ExploreInterval: time.Second,
+		ExploreTimeout:  500 * time.Millisecond,
+		PeerTTL:         10 * time.Second,
+	}
+	if cadence := g.resolveCadence(); cadence != expected {
+		t.Fatalf("expected %v, got %v", expected, cadence)
+	}
+}
+
+func TestRunCycleReconcilesWhenExplorersReturn(t *testing.T) {
+	g := &Group{
+		Name: "test",
+		Explorers: []explorer.Explorer{
+			&cadenceExplorer{cadence: explorer.Cadence{ExploreInterval: 10 * time.Second, ExploreTimeout: 5 * time.Second}},
+		},
+	}
+
+	g.resetStatus(g.resolveCadence())
+
+	started := time.Now()
+	g.runCycle(context.Background(), []int{0})
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Fatalf("expected cycle to end once the explorer returned, took %s", elapsed)
+	}
+
+	if s := g.Status(); len(s.Peers) != 1 {
+		t.Fatalf("expected one peer, got %v", s.Peers)
+	}
+}
+
+func TestSourcesExpireByTheirExplorerTTL(t *testing.T) {
+	g := &Group{Name: "test"}
+	fast := &sourceHandler{group: g, source: "fast", ttl: 10 * time.Millisecond}
+	slow := &sourceHandler{group: g, source: "slow", ttl: time.Hour}
+
+	fast.Discovered(&explorer.Discovery{ID: "a", IPv4Addr: net.ParseIP("10.0.0.1")})
+	slow.Discovered(&explorer.Discovery{ID: "b", IPv4Addr: net.ParseIP("10.0.0.2")})
+	if _, newPeers, _ := g.Reconcile(context.Background(), time.Hour); len(newPeers) != 2 {
+		t.Fatalf("expected two new peers, got %v", newPeers)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	peers, _, lostPeers := g.Reconcile(context.Background(), time.Hour)
+	if len(lostPeers) != 1 || lostPeers[0].ID != "a" || len(peers) != 1 || peers[0].ID != "b" {
+		t.Fatalf("expected only the peer of the fast explorer to expire, got %v and %v", peers, lostPeers)
+	}
+}
+
+func TestReconcileLeavesPeersOfIdleSources(t *testing.T) {
+	g := &Group{Name: "test"}
+	slow := &sourceHandler{group: g, source: "slow", ttl: 10 * time.Millisecond}
+
+	slow.Discovered(&explorer.Discovery{ID: "a", IPv4Addr: net.ParseIP("10.0.0.1")})
+	if _, newPeers, _ := g.Reconcile(context.Background(), time.Hour); len(newPeers) != 1 {
+		t.Fatalf("expected one new peer, got %v", newPeers)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	idle := map[string]bool{"slow": true}
+	if _, _, lostPeers := g.reconcile(context.Background(), time.Hour, idle); len(lostPeers) != 0 {
+		t.Fatalf("expected peer of an idle explorer to be kept, got %v", lostPeers)
+	}
+
+	if _, _, lostPeers := g.reconcile(context.Background(), time.Hour, nil); len(lostPeers) != 1 {
+		t.Fatalf("expected peer to be lost once its explorer ran, got %v", lostPeers)
+	}
+}
+
+// blockingExplorer does not return from Explore before it runs out of time.
+type blockingExplorer struct {
+	cadenceExplorer
+}
+
+func (e *blockingExplorer) Explore(ctx context.Context, dh explorer.DiscoveryHandler) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// countingExplorer counts its calls and discovers one peer.
+type countingExplorer struct {
+	cadenceExplorer
+	calls atomic.Int32
+}
+
+func (e *countingExplorer) Explore(ctx context.Context, dh explorer.DiscoveryHandler) error {
+	e.calls.Add(1)
+	dh.Discovered(&explorer.Discovery{ID: "fast", IPv4Addr: net.ParseIP("10.0.0.1")})
+	return nil
+}
+
+func TestRunDoesNotHoldFastExplorersForSlowOnes(t *testing.T) {
+	fast := &countingExplorer{cadenceExplorer: cadenceExplorer{cadence: explorer.Cadence{ExploreInterval: 20 * time.Millisecond, ExploreTimeout: 10 * time.Millisecond, PeerTTL: time.Second}}}
+	slow := &blockingExplorer{cadenceExplorer: cadenceExplorer{cadence: explorer.Cadence{ExploreInterval: time.Hour, ExploreTimeout: time.Hour, PeerTTL: time.Hour}}}
+	h := &notifyingHandler{newPeers: make(chan *peer.Peer, 1), lostPeers: make(chan *peer.Peer, 1)}
+	g := &Group{
+		Name:          "test",
+		Explorers:     []explorer.Explorer{slow, fast},
+		ExplorerNames: []string{"test:slow", "test:fast"},
+		Handlers:      []handler.Handler{h},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		g.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	select {
+	case p := <-h.newPeers:
+		if p.ID != "fast" {
+			t.Fatalf("unexpected new peer: %+v", p)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected peer of the fast explorer to be announced while the slow one runs")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for fast.calls.Load() < 5 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the fast explorer to keep its cadence, called %d time(s)", fast.calls.Load())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+type countingStore struct {
+	testStore
+	saves int
+}
+
+func (s *countingStore) Save(group string, peers []*peer.Peer) error {
+	s.saves++
+	return s.testStore.Save(group, peers)
+}
+
+func TestSaveStateSkipsUnchangedPeers(t *testing.T) {
+	store := &countingStore{testStore: testStore{peers: make(map[string][]*peer.Peer)}}
+	g := &Group{Name: "test", Store: store}
+	if err := g.Restore(20 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	discover := func(ip string) {
+		g.Discovered(&explorer.Discovery{ID: "a", IPv4Addr: net.ParseIP(ip)})
+		peers, _, _ := g.Reconcile(context.Background(), time.Second)
+		g.saveState(peers)
+	}
+
+	discover("10.0.0.1")
+	discover("10.0.0.1")
+	if store.saves != 1 {
+		t.Fatalf("expected unchanged peers to be saved once, got %d saves", store.saves)
+	}
+
+	discover("10.0.0.2")
+	if store.saves != 2 {
+		t.Fatalf("expected changed address to be saved, got %d saves", store.saves)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	discover("10.0.0.2")
+	if store.saves != 3 {
+		t.Fatalf("expected peers to be saved again after the grace period, got %d saves", store.saves)
+	}
+}
+
+// stuckExplorer ignores its deadline until it is released.
+type stuckExplorer struct {
+	cadenceExplorer
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (e *stuckExplorer) Explore(ctx context.Context, dh explorer.DiscoveryHandler) error {
+	e.calls.Add(1)
+	<-e.release
+	return nil
+}
+
+func TestAbandonedExplorerIsNotCalledAgainAfterReload(t *testing.T) {
+	cadence := explorer.Cadence{ExploreInterval: time.Second, ExploreTimeout: 10 * time.Millisecond, PeerTTL: time.Second}
+	stuck := &stuckExplorer{cadenceExplorer: cadenceExplorer{cadence: cadence}, release: make(chan struct{})}
+	defer close(stuck.release)
+
+	g := &Group{Name: "test", Explorers: []explorer.Explorer{stuck}}
+	g.resetStatus(cadence)
+	g.runCycle(context.Background(), []int{0})
+
+	g.Explorers = []explorer.Explorer{&testExplorer{}, stuck}
+	g.resetStatus(cadence)
+	g.runCycle(context.Background(), []int{1})
+
+	if calls := stuck.calls.Load(); calls != 1 {
+		t.Fatalf("expected abandoned explorer not to be called again, got %d calls", calls)
+	}
+}
+
+func TestDegradedHandlerRecoversOnlyOnceDeliveriesSucceed(t *testing.T) {
+	h := &failingHandler{failures: 1}
+	g := &Group{
+		Name:            "test",
+		Handlers:        []handler.Handler{h},
+		HandlerPolicies: []HandlerPolicy{{OnFailure: OnFailureDegrade}},
+	}
+	g.resetStatus(explorer.Cadence{})
+
+	ctx := context.Background()
+	if err := g.deliver(ctx, 0, []delivery{{hook: HookNewPeer, peer: &peer.Peer{ID: "a"}}}); err == nil {
+		t.Fatalf("expected delivery to fail")
+	}
+
+	pre := func(ctx context.Context) error { return h.PreExploration(ctx, nil) }
+	if err := g.callHandler(ctx, 0, HookPreExploration, pre); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !g.degraded[h] {
+		t.Fatalf("expected handler to stay degraded while its delivery is pending")
+	}
+
+	if err := g.deliver(ctx, 0, nil); err != nil {
+		t.Fatalf("unexpected error delivering again: %v", err)
+	}
+
+	if g.degraded[h] || len(h.newPeers) != 1 {
+		t.Fatalf("expected handler to recover once the pending delivery succeeded")
+	}
+}
+
+func TestShutdownWaitsForAbandonedCall(t *testing.T) {
+	h := &hangingHandler{release: make(chan struct{})}
+	g := &Group{
+		Name:            "test",
+		Handlers:        []handler.Handler{h},
+		HandlerPolicies: []HandlerPolicy{{Timeout: 10 * time.Millisecond}},
+	}
+	g.resetStatus(explorer.Cadence{})
+
+	call := func(ctx context.Context) error { return h.NewPeer(ctx, &peer.Peer{}) }
+	if err := g.callHandler(context.Background(), 0, HookNewPeer, call); err == nil {
+		t.Fatalf("expected hanging call to fail")
+	}
+
+	time.AfterFunc(20*time.Millisecond, func() { close(h.release) })
+
+	shutdown := func(context.Context) error { return nil }
+	if err := g.callHandler(context.Background(), 0, HookShutdown, shutdown); err != nil {
+		t.Fatalf("expected shutdown hook to wait for the abandoned call, got %v", err)
+	}
+}
@@ -0,0 +1,404 @@
+package group
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ravenix/peerd/internal/metrics"
+	"github.com/ravenix/peerd/internal/peer"
+	"github.com/ravenix/peerd/pkg/handler"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	OnFailureIgnore  = "ignore"
+	OnFailureRetry   = "retry"
+	OnFailureDegrade = "degrade"
+	OnFailureExit    = "exit"
+)
+
+const (
+	maxRetries = 10
+	maxBackoff = time.Minute
+)
+
+// HandlerPolicy controls how the hooks of a handler are called. A call is
+// attempted Retries more times after it failed, waiting Backoff before the
+// first retry and twice as long before every following one, but no longer
+// than a minute unless Backoff itself is. OnFailure decides what happens once
+// all attempts failed; unless it is OnFailureIgnore, new-peer and lost-peer
+// hooks are delivered again in the next cycle.
+type HandlerPolicy struct {
+	Timeout   time.Duration
+	Retries   int
+	Backoff   time.Duration
+	OnFailure string
+}
+
+// errHookRunning is returned for a hook of a handler which is still busy with
+// an earlier call, one abandoned after it timed out.
+var errHookRunning = errors.New("an earlier call has not returned yet")
+
+type delivery struct {
+	hook string
+	peer *peer.Peer
+}
+
+func (p HandlerPolicy) Validate() error {
+	if p.Timeout < 0 || p.Backoff < 0 {
+		return fmt.Errorf("timeout and backoff must not be negative")
+	}
+
+	if p.Retries < 0 || p.Retries > maxRetries {
+		return fmt.Errorf("retries must be between 0 and %d", maxRetries)
+	}
+
+	switch p.OnFailure {
+	case "", OnFailureIgnore, OnFailureRetry, OnFailureDegrade, OnFailureExit:
+	default:
+		return fmt.Errorf("unknown failure policy '%s'", p.OnFailure)
+	}
+
+	return nil
+}
+
+// backoff is the delay before the retry following the given attempt.
+func (p HandlerPolicy) backoff(attempt int) time.Duration {
+	limit := max(p.Backoff, maxBackoff)
+
+	delay := p.Backoff
+	for range attempt {
+		if delay >= limit/2 {
+			return limit
+		}
+		delay *= 2
+	}
+
+	return delay
+}
+
+func (p HandlerPolicy) redeliver() bool {
+	return p.OnFailure != OnFailureIgnore
+}
+
+func (g *Group) handlerPolicy(idx int) HandlerPolicy {
+	if idx < len(g.HandlerPolicies) {
+		return g.HandlerPolicies[idx]
+	}
+
+	return HandlerPolicy{}
+}
+
+// callHandler runs a hook of the handler according to its policy and records
+// the outcome. A handler is never called while an earlier call is still
+// running; a retry waits as long as the timeout for it to return, and the
+// shutdown hook as long as ctx lasts.
+func (g *Group) callHandler(ctx context.Context, idx int, hook string, call func(context.Context) error) error {
+	policy := g.handlerPolicy(idx)
+	slot := g.hookSlot(g.Handlers[idx])
+	started := time.Now()
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		wait := time.Duration(0)
+		switch {
+		case hook == HookShutdown:
+			wait = -1
+		case attempt > 0:
+			wait = policy.Timeout
+		}
+
+		if err = acquireHook(ctx, slot, wait); err == nil {
+			err = runHook(ctx, policy.Timeout, func(ctx context.Context) error {
+				defer func() { <-slot }()
+				return call(ctx)
+			})
+		}
+
+		if err == nil || attempt >= policy.Retries || ctx.Err() != nil {
+			break
+		}
+
+		delay := policy.backoff(attempt)
+		log.Debugf("Retrying %s hook for group '%s' of handler '%s' in %s: %v", hook, g.Name, g.handlerName(idx), delay, err)
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	duration := g.recordCall(true, idx, hook, started, err)
+	metrics.ObserveHook(g.Name, g.handlerName(idx), hook, duration, err)
+	if hook != HookNewPeer && hook != HookLostPeer {
+		g.setDegraded(idx, err)
+	}
+	g.observeHandler(idx)
+
+	if err != nil && policy.OnFailure == OnFailureExit && hook != HookShutdown {
+		g.exit(fmt.Errorf("handler '%s' of group '%s' failed running %s hook: %w", g.handlerName(idx), g.Name, hook, err))
+	}
+
+	return err
+}
+
+// exit asks for peerd to shut down. Without an Exit function the process ends
+// right away.
+func (g *Group) exit(err error) {
+	if g.Exit == nil {
+		log.Fatalf("Exiting: %v", err)
+	}
+
+	log.Errorf("Shutting down: %v", err)
+	g.Exit(err)
+}
+
+// hookSlot returns the channel which holds a value while a hook of the handler
+// runs, including a call abandoned after it timed out.
+func (g *Group) hookSlot(h handler.Handler) chan struct{} {
+	g.statusMu.Lock()
+	defer g.statusMu.Unlock()
+
+	if g.calling == nil {
+		g.calling = make(map[handler.Handler]chan struct{})
+	}
+
+	slot, ok := g.calling[h]
+	if !ok {
+		slot = make(chan struct{}, 1)
+		g.calling[h] = slot
+	}
+
+	return slot
+}
+
+// acquireHook takes the slot of a handler, waiting up to wait for an earlier
+// call to return, or as long as ctx lasts if wait is negative.
+func acquireHook(ctx context.Context, slot chan struct{}, wait time.Duration) error {
+	select {
+	case slot <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if wait == 0 {
+		return errHookRunning
+	}
+
+	var timeout <-chan time.Time
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case slot <- struct{}{}:
+		return nil
+	case <-timeout:
+		return errHookRunning
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// runHook calls the hook with a deadline. A hook that does not return in time
+// is abandoned so that it cannot hold up the group.
+func runHook(ctx context.Context, timeout time.Duration, call func(context.Context) error) error {
+	if timeout <= 0 {
+		return call(ctx)
+	}
+
+	hookCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- call(hookCtx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-hookCtx.Done():
+		if errors.Is(hookCtx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("timed out after %s", timeout)
+		}
+		return hookCtx.Err()
+	}
+}
+
+// deliver passes new and lost peers to the handler, after whatever it failed
+// to take in earlier cycles. It returns the first error of the handler.
+func (g *Group) deliver(ctx context.Context, idx int, deliveries []delivery) error {
+	h := g.Handlers[idx]
+	policy := g.handlerPolicy(idx)
+
+	g.statusMu.Lock()
+	queue := compactDeliveries(append(g.pending[h], deliveries...))
+	delete(g.pending, h)
+	g.statusMu.Unlock()
+
+	var failed error
+	for i, d := range queue {
+		var err error
+		switch d.hook {
+		case HookNewPeer:
+			err = g.callHandler(ctx, idx, d.hook, func(ctx context.Context) error { return h.NewPeer(ctx, d.peer) })
+			if err != nil {
+				log.Warnf("Failed running new-peer hook for group '%s' of handler '%s': %v", g.Name, g.handlerName(idx), err)
+			}
+		case HookLostPeer:
+			err = g.callHandler(ctx, idx, d.hook, func(ctx context.Context) error { return h.LostPeer(ctx, d.peer) })
+			if err != nil {
+				log.Warnf("Failed running lost-peer hook for group '%s' of handler '%s': %v", g.Name, g.handlerName(idx), err)
+			}
+		}
+
+		if err == nil {
+			continue
+		}
+
+		if failed == nil {
+			failed = err
+		}
+
+		if policy.redeliver() {
+			g.postpone(idx, queue[i:])
+			break
+		}
+	}
+
+	g.setDegraded(idx, failed)
+	g.observeHandler(idx)
+	return failed
+}
+
+// postpone queues deliveries for the handler until the next cycle, unless its
+// policy drops failed deliveries.
+func (g *Group) postpone(idx int, deliveries []delivery) {
+	if len(deliveries) == 0 || !g.handlerPolicy(idx).redeliver() {
+		return
+	}
+
+	h := g.Handlers[idx]
+	log.Infof("Delivering %d peer change(s) to handler '%s' of group '%s' again in the next cycle", len(deliveries), g.handlerName(idx), g.Name)
+
+	g.statusMu.Lock()
+	if g.pending == nil {
+		g.pending = make(map[handler.Handler][]delivery)
+	}
+	g.pending[h] = append(g.pending[h], deliveries...)
+	g.statusMu.Unlock()
+
+	g.observeHandler(idx)
+}
+
+// compactDeliveries drops a new peer together with its loss when the handler
+// has not seen either of them yet.
+func compactDeliveries(queue []delivery) []delivery {
+	dropped := make([]bool, len(queue))
+	for j, lost := range queue {
+		if lost.hook != HookLostPeer {
+			continue
+		}
+
+		for i := 0; i < j; i++ {
+			if !dropped[i] && queue[i].hook == HookNewPeer && samePeer(queue[i].peer, lost.peer) {
+				dropped[i], dropped[j] = true, true
+				break
+			}
+		}
+	}
+
+	var tmp []delivery
+	for idx, d := range queue {
+		if !dropped[idx] {
+			tmp = append(tmp, d)
+		}
+	}
+	return tmp
+}
+
+func samePeer(a *peer.Peer, b *peer.Peer) bool {
+	return a.ID == b.ID && a.FirstSeen.Equal(b.FirstSeen)
+}
+
+// setDegraded records the outcome of calling the handler. A handler whose
+// policy degrades the group is degraded by a failure, and recovers once a call
+// succeeds while none of its deliveries are pending, so that a successful hook
+// does not hide failed deliveries.
+func (g *Group) setDegraded(idx int, err error) {
+	h := g.Handlers[idx]
+	policy := g.handlerPolicy(idx)
+
+	g.statusMu.Lock()
+	defer g.statusMu.Unlock()
+
+	degraded := false
+	if policy.OnFailure == OnFailureDegrade {
+		degraded = err != nil || (g.degraded[h] && len(g.pending[h]) > 0)
+	}
+
+	if g.degraded[h] == degraded {
+		return
+	}
+
+	if degraded {
+		if g.degraded == nil {
+			g.degraded = make(map[handler.Handler]bool)
+		}
+		g.degraded[h] = true
+		log.Errorf("Group '%s' is degraded, handler '%s' keeps failing", g.Name, g.handlerName(idx))
+	} else {
+		delete(g.degraded, h)
+		log.Infof("Handler '%s' of group '%s' recovered", g.handlerName(idx), g.Name)
+	}
+}
+
+func (g *Group) observeHandler(idx int) {
+	h := g.Handlers[idx]
+
+	g.statusMu.Lock()
+	pending, degraded := len(g.pending[h]), g.degraded[h]
+	if idx < len(g.handlerStatus) {
+		g.handlerStatus[idx].Pending = pending
+		g.handlerStatus[idx].Degraded = degraded
+	}
+	g.statusMu.Unlock()
+
+	metrics.ObserveHandler(g.Name, g.handlerName(idx), pending, degraded)
+}
+
+// forgetHandlers drops the queued deliveries, degradation and call slots of
+// handlers which are no longer part of the group.
+func (g *Group) forgetHandlers() {
+	current := make(map[handler.Handler]bool, len(g.Handlers))
+	for _, h := range g.Handlers {
+		current[h] = true
+	}
+
+	for h := range g.pending {
+		if !current[h] {
+			delete(g.pending, h)
+		}
+	}
+
+	for h := range g.degraded {
+		if !current[h] {
+			delete(g.degraded, h)
+		}
+	}
+
+	for h := range g.calling {
+		if !current[h] {
+			delete(g.calling, h)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package group
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ravenix/peerd/internal/peer"
+	"github.com/ravenix/peerd/pkg/explorer"
+)
+
+// peerIndex finds the peers a discovery merges with without visiting every
+// source of every peer. Entries are counted per peer, since several sources of
+// a peer, or even several peers, may share one.
+type peerIndex struct {
+	merge     MergePolicy
+	entries   map[string]map[*peer.Peer]int
+	streamers map[explorer.Explorer]map[*peer.Peer]int
+}
+
+// peerIndex returns the index of the peers, which is rebuilt when the merge
+// policy changed since it was built. g.mu must be held.
+func (g *Group) peerIndex() *peerIndex {
+	if g.index != nil && g.index.merge == g.Merge {
+		return g.index
+	}
+
+	g.index = &peerIndex{
+		merge:     g.Merge,
+		entries:   make(map[string]map[*peer.Peer]int),
+		streamers: make(map[explorer.Explorer]map[*peer.Peer]int),
+	}
+	for _, p := range g.peers {
+		if st := g.state[p]; st != nil {
+			g.index.add(p, st)
+		}
+	}
+
+	return g.index
+}
+
+// add indexes the sources of the peer.
+func (x *peerIndex) add(p *peer.Peer, st *peerState) {
+	for key, s := range st.sources {
+		for _, entry := range indexEntries(x.merge, key, &s.discovery) {
+			countPeer(x.entries, entry, p, 1)
+		}
+
+		if s.streamer != nil {
+			countPeer(x.streamers, s.streamer, p, 1)
+		}
+	}
+}
+
+// remove drops the sources of the peer from the index. It must be called
+// before the sources change, with the sources that were added.
+func (x *peerIndex) remove(p *peer.Peer, st *peerState) {
+	for key, s := range st.sources {
+		for _, entry := range indexEntries(x.merge, key, &s.discovery) {
+			countPeer(x.entries, entry, p, -1)
+		}
+
+		if s.streamer != nil {
+			countPeer(x.streamers, s.streamer, p, -1)
+		}
+	}
+}
+
+// bySource returns the peer holding the source.
+func (x *peerIndex) bySource(key string) *peer.Peer {
+	for p := range x.entries[sourceEntry(key)] {
+		return p
+	}
+
+	return nil
+}
+
+// matching returns the peers with a source the discovery merges with.
+func (x *peerIndex) matching(d *explorer.Discovery) []*peer.Peer {
+	var peers []*peer.Peer
+	for _, entry := range matchEntries(x.merge, d) {
+		for p := range x.entries[entry] {
+			peers = append(peers, p)
+		}
+	}
+
+	return peers
+}
+
+// streamedBy returns the peers the streamer reported.
+func (x *peerIndex) streamedBy(e explorer.Explorer) []*peer.Peer {
+	var peers []*peer.Peer
+	for p := range x.streamers[e] {
+		peers = append(peers, p)
+	}
+
+	return peers
+}
+
+func countPeer[K comparable](entries map[K]map[*peer.Peer]int, key K, p *peer.Peer, n int) {
+	peers := entries[key]
+	if peers == nil {
+		peers = make(map[*peer.Peer]int)
+		entries[key] = peers
+	}
+
+	if peers[p] += n; peers[p] <= 0 {
+		delete(peers, p)
+	}
+
+	if len(peers) == 0 {
+		delete(entries, key)
+	}
+}
+
+// indexEntries are the entries a source is found by.
+func indexEntries(merge MergePolicy, key string, d *explorer.Discovery) []string {
+	return append(matchEntries(merge, d), sourceEntry(key))
+}
+
+// matchEntries are the entries shared by discoveries which merge: the ID or,
+// without one, the addresses and port, and what the merge policy matches on,
+// any address or the value of the label.
+func matchEntries(merge MergePolicy, d *explorer.Discovery) []string {
+	var entries []string
+	if d.ID != "" {
+		entries = append(entries, "id\x00"+d.ID)
+	} else {
+		entries = append(entries, addressesEntry(d))
+	}
+
+	switch merge.Match {
+	case MatchAddress:
+		for _, address := range d.Addresses {
+			entries = append(entries, "ip\x00"+address.IP.String())
+		}
+	case MatchLabel:
+		if value := d.Labels[merge.Label]; value != "" {
+			entries = append(entries, "label\x00"+value)
+		}
+	}
+
+	return entries
+}
+
+func sourceEntry(key string) string {
+	return "source\x00" + key
+}
+
+// addressesEntry is shared by ID-less discoveries with the same addresses and
+// port, as compared by peer.SameAddresses.
+func addressesEntry(d *explorer.Discovery) string {
+	addresses := make([]string, 0, len(d.Addresses))
+	for _, address := range d.Addresses {
+		addresses = append(addresses, address.IP.String()+"\x01"+address.Scope+"\x01"+address.Label)
+	}
+	sort.Strings(addresses)
+
+	return fmt.Sprintf("addresses\x00%s\x00%d", strings.Join(addresses, ","), d.Port)
+}
@@ -0,0 +1,147 @@
+package group
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ravenix/peerd/internal/peer"
+	"github.com/ravenix/peerd/pkg/explorer"
+)
+
+const (
+	MatchID      = "id"
+	MatchAddress = "address"
+	MatchLabel   = "label"
+)
+
+// MergePolicy decides when discoveries of different explorers describe the
+// same peer. Discoveries carrying the same ID, or ID-less discoveries with the
+// same addresses and port, are always merged.
+type MergePolicy struct {
+	Match string
+	Label string
+}
+
+func NewMergePolicy(match string, label string) (MergePolicy, error) {
+	switch match {
+	case "":
+		match = MatchID
+	case MatchID, MatchAddress:
+	case MatchLabel:
+		if label == "" {
+			return MergePolicy{}, fmt.Errorf("merge policy '%s' requires a label", match)
+		}
+	default:
+		return MergePolicy{}, fmt.Errorf("unknown merge policy '%s'", match)
+	}
+
+	if label != "" && match != MatchLabel {
+		return MergePolicy{}, fmt.Errorf("label can only be set for merge policy '%s'", MatchLabel)
+	}
+
+	return MergePolicy{Match: match, Label: label}, nil
+}
+
+// source is what a single explorer last reported about a peer. Sources of
+// streaming explorers, which carry the streamer, do not expire until they are
+// removed or the streamer stopped.
+type source struct {
+	name      string
+	discovery explorer.Discovery
+	lastSeen  time.Time
+	ttl       time.Duration
+	streamer  explorer.Explorer
+	removed   bool
+}
+
+type sourceHandler struct {
+	group  *Group
+	source string
+	ttl    time.Duration
+}
+
+func (h *sourceHandler) Discovered(d *explorer.Discovery) {
+	h.group.discovered(source{name: h.source, ttl: h.ttl}, d)
+}
+
+func sourceKey(name string, d *explorer.Discovery) string {
+	if d.ID != "" {
+		return name + "\x00" + d.ID
+	}
+
+	ips := make([]string, 0, len(d.Addresses))
+	for _, address := range d.Addresses {
+		ips = append(ips, address.IP.String())
+	}
+	sort.Strings(ips)
+
+	return fmt.Sprintf("%s\x00%s\x00%d", name, strings.Join(ips, ","), d.Port)
+}
+
+// mergeSources rebuilds the peer from everything its sources reported. Sources
+// are visited in a stable order; the first non-empty ID, name and port win,
+// labels and addresses are combined.
+func mergeSources(p *peer.Peer, sources map[string]*source) {
+	keys := make([]string, 0, len(sources))
+	for key := range sources {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	p.ID, p.Name, p.Port = "", "", 0
+	p.Labels, p.Addresses, p.Sources = nil, nil, nil
+
+	seenIPs := make(map[string]bool)
+	for _, key := range keys {
+		s := sources[key]
+		d := &s.discovery
+
+		if p.ID == "" {
+			p.ID = d.ID
+		}
+
+		if p.Name == "" {
+			p.Name = d.Name
+		}
+
+		if p.Port == 0 {
+			p.Port = d.Port
+		}
+
+		for k, v := range d.Labels {
+			if p.Labels == nil {
+				p.Labels = make(map[string]string)
+			}
+
+			if _, ok := p.Labels[k]; !ok {
+				p.Labels[k] = v
+			}
+		}
+
+		for _, address := range d.Addresses {
+			if !seenIPs[address.IP.String()] {
+				seenIPs[address.IP.String()] = true
+				p.Addresses = append(p.Addresses, address)
+			}
+		}
+
+		if s.name != "" && !containsString(p.Sources, s.name) {
+			p.Sources = append(p.Sources, s.name)
+		}
+	}
+
+	sort.Strings(p.Sources)
+	p.IPv4Addr, p.IPv6Addr = (&explorer.Discovery{Addresses: p.Addresses}).PrimaryAddresses()
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
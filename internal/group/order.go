@@ -0,0 +1,179 @@
+package group
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DependencyError is a problem with the id or after list of the handler at
+// Index.
+type DependencyError struct {
+	Index int
+	Err   error
+}
+
+func (e *DependencyError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DependencyError) Unwrap() error {
+	return e.Err
+}
+
+func dependencyError(idx int, format string, args ...any) error {
+	return &DependencyError{Index: idx, Err: fmt.Errorf(format, args...)}
+}
+
+// ResolveDependencies turns the after lists of handlers into the indexes of
+// the handlers each one has to wait for. An entry of an after list refers to
+// the id of a handler, or to its name if no other handler has the same one.
+// Problems are reported as a DependencyError.
+func ResolveDependencies(ids []string, names []string, after [][]string) ([][]int, error) {
+	byID := make(map[string]int)
+	for idx, id := range ids {
+		if id == "" {
+			continue
+		}
+
+		if _, ok := byID[id]; ok {
+			return nil, dependencyError(idx, "handler id '%s' is used more than once", id)
+		}
+		byID[id] = idx
+	}
+
+	byName := make(map[string][]int)
+	for idx, name := range names {
+		byName[name] = append(byName[name], idx)
+	}
+
+	lookup := func(ref string) []int {
+		if idx, ok := byID[ref]; ok {
+			return []int{idx}
+		}
+		return byName[ref]
+	}
+
+	deps := make([][]int, len(names))
+	for idx := range names {
+		if idx >= len(after) {
+			continue
+		}
+
+		for _, ref := range after[idx] {
+			matches := lookup(ref)
+			switch {
+			case len(matches) == 0:
+				return nil, dependencyError(idx, "handler '%s' runs after unknown handler '%s'", names[idx], ref)
+			case len(matches) > 1:
+				return nil, dependencyError(idx, "handler '%s' runs after '%s', which matches more than one handler, use an id", names[idx], ref)
+			case matches[0] == idx:
+				return nil, dependencyError(idx, "handler '%s' cannot run after itself", names[idx])
+			}
+
+			deps[idx] = append(deps[idx], matches[0])
+		}
+	}
+
+	if cycle := findCycle(deps); cycle != nil {
+		var path []string
+		for _, idx := range cycle {
+			path = append(path, names[idx])
+		}
+		return nil, dependencyError(cycle[0], "handlers depend on each other: %s", strings.Join(path, " -> "))
+	}
+
+	return deps, nil
+}
+
+func findCycle(deps [][]int) []int {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make([]int, len(deps))
+	var stack []int
+
+	var visit func(idx int) []int
+	visit = func(idx int) []int {
+		state[idx] = visiting
+		stack = append(stack, idx)
+
+		for _, dep := range deps[idx] {
+			switch state[dep] {
+			case visiting:
+				for pos, entry := range stack {
+					if entry == dep {
+						return append(append([]int{}, stack[pos:]...), dep)
+					}
+				}
+			case unvisited:
+				if cycle := visit(dep); cycle != nil {
+					return cycle
+				}
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		state[idx] = visited
+		return nil
+	}
+
+	for idx := range deps {
+		if state[idx] == unvisited {
+			if cycle := visit(idx); cycle != nil {
+				return cycle
+			}
+		}
+	}
+
+	return nil
+}
+
+// runHandlers calls run for every handler at once, except that a handler waits
+// for the handlers it depends on. When one of them failed or was skipped, the
+// handler is skipped as well and skipped is called for it instead.
+func (g *Group) runHandlers(hook string, run func(idx int) error, skipped func(idx int)) {
+	done := make([]chan struct{}, len(g.Handlers))
+	failed := make([]bool, len(g.Handlers))
+	for idx := range done {
+		done[idx] = make(chan struct{})
+	}
+
+	var wg sync.WaitGroup
+	for idx := range g.Handlers {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			defer close(done[idx])
+
+			for _, dep := range g.handlerDependencies(idx) {
+				<-done[dep]
+				if failed[dep] {
+					log.Warnf("Skipping %s hook for group '%s' of handler '%s', handler '%s' did not succeed", hook, g.Name, g.handlerName(idx), g.handlerName(dep))
+					failed[idx] = true
+					if skipped != nil {
+						skipped(idx)
+					}
+					return
+				}
+			}
+
+			failed[idx] = run(idx) != nil
+		}(idx)
+	}
+
+	wg.Wait()
+}
+
+func (g *Group) handlerDependencies(idx int) []int {
+	if idx < len(g.HandlerDependencies) {
+		return g.HandlerDependencies[idx]
+	}
+
+	return nil
+}
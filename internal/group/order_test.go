@@ -0,0 +1,95 @@
+package group
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ravenix/peerd/internal/peer"
+	"github.com/ravenix/peerd/pkg/handler"
+)
+
+func TestResolveDependencies(t *testing.T) {
+	deps, err := ResolveDependencies(
+		[]string{"", "reload", ""},
+		[]string{"template:file", "exec:command", "exec:command"},
+		[][]string{nil, {"template:file"}, {"reload", "template:file"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(deps[0]) != 0 || len(deps[1]) != 1 || deps[1][0] != 0 || len(deps[2]) != 2 || deps[2][0] != 1 {
+		t.Fatalf("unexpected dependencies: %v", deps)
+	}
+
+	for _, tc := range []struct {
+		ids   []string
+		after [][]string
+		err   string
+	}{
+		{[]string{"", "", ""}, [][]string{nil, {"webhook"}}, "unknown handler"},
+		{[]string{"", "", ""}, [][]string{{"exec:command"}}, "more than one handler"},
+		{[]string{"a", "a", ""}, nil, "used more than once"},
+		{[]string{"a", "b", "c"}, [][]string{{"c"}, {"a"}, {"b"}}, "depend on each other"},
+	} {
+		_, err := ResolveDependencies(tc.ids, []string{"template:file", "exec:command", "exec:command"}, tc.after)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("expected error containing '%s', got %v", tc.err, err)
+		}
+	}
+}
+
+type orderedHandler struct {
+	testHandler
+	name  string
+	err   error
+	delay time.Duration
+
+	mu    *sync.Mutex
+	calls *[]string
+}
+
+func (h *orderedHandler) PostExploration(context.Context, []*peer.Peer, []*peer.Peer, []*peer.Peer) error {
+	time.Sleep(h.delay)
+
+	h.mu.Lock()
+	*h.calls = append(*h.calls, h.name)
+	h.mu.Unlock()
+
+	return h.err
+}
+
+func TestRunHandlersRespectsDependencies(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	newHandler := func(name string, delay time.Duration, err error) *orderedHandler {
+		return &orderedHandler{name: name, delay: delay, err: err, mu: &mu, calls: &calls}
+	}
+
+	handlers := []*orderedHandler{
+		newHandler("template", 20*time.Millisecond, nil),
+		newHandler("webhook", 0, errors.New("unreachable")),
+		newHandler("reload", 0, nil),
+		newHandler("notify", 0, nil),
+	}
+
+	g := &Group{Name: "test", HandlerDependencies: [][]int{nil, nil, {0}, {1}}}
+	for _, h := range handlers {
+		g.Handlers = append(g.Handlers, handler.Handler(h))
+	}
+	g.resetStatus(g.cadence)
+
+	g.runHandlers(HookPostExploration, func(idx int) error {
+		return g.callHandler(context.Background(), idx, HookPostExploration, func(ctx context.Context) error {
+			return g.Handlers[idx].PostExploration(ctx, nil, nil, nil)
+		})
+	}, nil)
+
+	if strings.Join(calls, ",") != "webhook,template,reload" {
+		t.Fatalf("unexpected calls: %v", calls)
+	}
+}
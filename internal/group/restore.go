@@ -0,0 +1,119 @@
+package group
+
+import (
+	"maps"
+	"time"
+
+	"github.com/ravenix/peerd/internal/peer"
+	"github.com/ravenix/peerd/pkg/explorer"
+	log "github.com/sirupsen/logrus"
+)
+
+// restoredSource is the key of the source standing in for a previous run of
+// peerd. No explorer can produce it.
+const restoredSource = "\x00"
+
+type Store interface {
+	Load(group string) ([]*peer.Peer, error)
+	Save(group string, peers []*peer.Peer) error
+}
+
+// Restore loads the peers saved by a previous run. They count as already
+// announced, and are neither lost nor reported as new while the grace period
+// lasts; an explorer confirming a peer replaces what was restored.
+func (g *Group) Restore(grace time.Duration) error {
+	if g.Store == nil {
+		return nil
+	}
+
+	peers, err := g.Store.Load(g.Name)
+	if err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.state == nil {
+		g.state = make(map[*peer.Peer]*peerState)
+	}
+
+	g.saveInterval = grace
+	graceEnds := time.Now().Add(grace)
+	restored := 0
+	for _, p := range peers {
+		if p.LastSeen.IsZero() {
+			continue
+		}
+		restored++
+
+		g.peers = append(g.peers, p)
+		g.state[p] = &peerState{
+			sources: map[string]*source{
+				restoredSource: {
+					discovery: explorer.Discovery{
+						ID:        p.ID,
+						Name:      p.Name,
+						Labels:    copyLabels(p.Labels),
+						Addresses: copyAddresses(p.Addresses),
+						Port:      p.Port,
+					},
+					lastSeen: graceEnds,
+				},
+			},
+			keys: make(map[string]bool),
+			seq:  g.nextSeq,
+		}
+		g.nextSeq++
+	}
+	g.index = nil
+
+	log.Infof("Restored %d peer(s) of group '%s', grace period %s", restored, g.Name, grace)
+	return nil
+}
+
+// saveState saves the peers when they changed since the last save. Updates
+// that only move LastSeen are saved at most once per grace period, since
+// Restore does not look further than whether a peer was seen.
+func (g *Group) saveState(peers []*peer.Peer) {
+	if g.Store == nil {
+		return
+	}
+
+	now := time.Now()
+	unchanged := !g.savedAt.IsZero() && samePeers(g.saved, peers)
+	if unchanged && (g.saveInterval <= 0 || now.Sub(g.savedAt) < g.saveInterval) {
+		return
+	}
+
+	if err := g.Store.Save(g.Name, peers); err != nil {
+		log.Warnf("Failed saving state of group '%s': %v", g.Name, err)
+		return
+	}
+
+	g.saved = make([]*peer.Peer, 0, len(peers))
+	for _, p := range peers {
+		tmp := *p
+		tmp.Labels = copyLabels(p.Labels)
+		tmp.Addresses = copyAddresses(p.Addresses)
+		g.saved = append(g.saved, &tmp)
+	}
+	g.savedAt = now
+}
+
+// samePeers reports whether b holds the peers of a with the same addresses and
+// labels, regardless of when they were last seen.
+func samePeers(a, b []*peer.Peer) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].ID != b[i].ID || a[i].Name != b[i].Name || !sameAddress(a[i], b[i].Addresses, b[i].Port) ||
+			!maps.Equal(a[i].Labels, b[i].Labels) || a[i].LastSeen.IsZero() != b[i].LastSeen.IsZero() {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,204 @@
+package group
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/ravenix/peerd/internal/metrics"
+	"github.com/ravenix/peerd/internal/peer"
+	"github.com/ravenix/peerd/pkg/explorer"
+)
+
+const (
+	HookExplore         = "explore"
+	HookPreExploration  = "pre_exploration"
+	HookNewPeer         = "new_peer"
+	HookLostPeer        = "lost_peer"
+	HookAddressChanged  = "address_changed"
+	HookPostExploration = "post_exploration"
+	HookShutdown        = "shutdown"
+)
+
+type Status struct {
+	Name      string
+	Degraded  bool
+	Cadence   explorer.Cadence
+	Peers     []*peer.Peer
+	Damping   []DampingStatus
+	LastCycle *CycleStatus
+	Explorers []ComponentStatus
+	Handlers  []ComponentStatus
+}
+
+type CycleStatus struct {
+	Started   time.Time
+	Duration  time.Duration
+	NewPeers  []*peer.Peer
+	LostPeers []*peer.Peer
+}
+
+type ComponentStatus struct {
+	Name     string
+	Calls    map[string]CallStatus
+	Pending  int
+	Degraded bool
+}
+
+type CallStatus struct {
+	Started  time.Time
+	Duration time.Duration
+	Error    string
+}
+
+func (g *Group) Status() Status {
+	g.statusMu.Lock()
+	defer g.statusMu.Unlock()
+
+	s := Status{
+		Name:      g.Name,
+		Cadence:   g.cadence,
+		Peers:     g.GetPeers(),
+		Damping:   g.DampingStatus(),
+		Explorers: copyComponentStatus(g.explorerStatus),
+		Handlers:  copyComponentStatus(g.handlerStatus),
+	}
+
+	if g.lastCycle != nil {
+		lastCycle := *g.lastCycle
+		s.LastCycle = &lastCycle
+	}
+
+	for _, h := range s.Handlers {
+		s.Degraded = s.Degraded || h.Degraded
+	}
+
+	return s
+}
+
+func (g *Group) resetStatus(cadence explorer.Cadence) {
+	g.statusMu.Lock()
+	defer g.statusMu.Unlock()
+
+	g.cadence = cadence
+	g.explorerStatus = make([]ComponentStatus, len(g.Explorers))
+	for idx, e := range g.Explorers {
+		g.explorerStatus[idx] = ComponentStatus{
+			Name:  componentName(g.ExplorerNames, idx, e),
+			Calls: make(map[string]CallStatus),
+		}
+	}
+
+	g.forgetExplorers()
+	g.forgetHandlers()
+	g.handlerStatus = make([]ComponentStatus, len(g.Handlers))
+	for idx, h := range g.Handlers {
+		g.handlerStatus[idx] = ComponentStatus{
+			Name:     g.handlerName(idx),
+			Calls:    make(map[string]CallStatus),
+			Pending:  len(g.pending[h]),
+			Degraded: g.degraded[h],
+		}
+	}
+}
+
+func (g *Group) recordExplorer(idx int, name string, started time.Time, err error) {
+	duration := g.recordCall(false, idx, HookExplore, started, err)
+	metrics.ObserveExplore(g.Name, name, duration, err)
+}
+
+func (g *Group) recordCall(handler bool, idx int, hook string, started time.Time, err error) time.Duration {
+	call := CallStatus{
+		Started:  started,
+		Duration: time.Since(started),
+	}
+
+	if err != nil {
+		call.Error = err.Error()
+	}
+
+	g.statusMu.Lock()
+	defer g.statusMu.Unlock()
+
+	components := g.explorerStatus
+	if handler {
+		components = g.handlerStatus
+	}
+
+	if idx < len(components) {
+		components[idx].Calls[hook] = call
+	}
+
+	return call.Duration
+}
+
+func (g *Group) recordCycle(started time.Time, peers []*peer.Peer, newPeers []*peer.Peer, lostPeers []*peer.Peer, successful bool) {
+	metrics.ObserveCycle(g.Name, len(peers), len(newPeers), len(lostPeers), successful)
+
+	g.statusMu.Lock()
+	defer g.statusMu.Unlock()
+
+	g.lastCycle = &CycleStatus{
+		Started:   started,
+		Duration:  time.Since(started),
+		NewPeers:  newPeers,
+		LostPeers: lostPeers,
+	}
+}
+
+func (g *Group) explorerName(idx int) string {
+	return componentName(g.ExplorerNames, idx, g.Explorers[idx])
+}
+
+// sourceName is the explorer name recorded on the peers it discovers. Explorers
+// configured more than once in a group are told apart by their position.
+func (g *Group) sourceName(idx int) string {
+	name := g.explorerName(idx)
+	for other := range g.Explorers {
+		if other != idx && g.explorerName(other) == name {
+			return fmt.Sprintf("%s#%d", name, idx)
+		}
+	}
+
+	return name
+}
+
+// handlerName is the name a handler is reported under. Handlers sharing a
+// name are told apart by their position, as explorers are by sourceName.
+func (g *Group) handlerName(idx int) string {
+	name := componentName(g.HandlerNames, idx, g.Handlers[idx])
+	for other := range g.Handlers {
+		if other != idx && componentName(g.HandlerNames, other, g.Handlers[other]) == name {
+			return fmt.Sprintf("%s#%d", name, idx)
+		}
+	}
+
+	return name
+}
+
+func componentName(names []string, idx int, component any) string {
+	if idx < len(names) && names[idx] != "" {
+		return names[idx]
+	}
+
+	return reflect.TypeOf(component).String()
+}
+
+func copyComponentStatus(components []ComponentStatus) []ComponentStatus {
+	tmp := make([]ComponentStatus, 0, len(components))
+	for _, c := range components {
+		calls := make(map[string]CallStatus, len(c.Calls))
+		for hook, call := range c.Calls {
+			calls[hook] = call
+		}
+
+		tmp = append(tmp, ComponentStatus{
+			Name:     c.Name,
+			Calls:    calls,
+			Pending:  c.Pending,
+			Degraded: c.Degraded,
+		})
+	}
+
+	return tmp
+}
@@ -0,0 +1,152 @@
+package group
+
+import (
+	"context"
+	"slices"
+
+	"github.com/ravenix/peerd/pkg/explorer"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	eventAdded   = "added"
+	eventUpdated = "updated"
+	eventRemoved = "removed"
+	eventStopped = "stopped"
+)
+
+type event struct {
+	explorer  explorer.Explorer
+	kind      string
+	discovery *explorer.Discovery
+}
+
+// eventHandler passes the events of a streaming explorer to the loop of the
+// group. It blocks while the group is not running, until ctx is done.
+type eventHandler struct {
+	ctx      context.Context
+	group    *Group
+	explorer explorer.Explorer
+}
+
+// Events returns the handler a streaming explorer of the group reports to for
+// as long as ctx lasts.
+func (g *Group) Events(ctx context.Context, e explorer.Explorer) explorer.EventHandler {
+	return &eventHandler{ctx: ctx, group: g, explorer: e}
+}
+
+func (h *eventHandler) Added(d *explorer.Discovery)   { h.send(eventAdded, d) }
+func (h *eventHandler) Updated(d *explorer.Discovery) { h.send(eventUpdated, d) }
+func (h *eventHandler) Removed(d *explorer.Discovery) { h.send(eventRemoved, d) }
+
+func (h *eventHandler) send(kind string, d *explorer.Discovery) {
+	tmp := *d
+	tmp.Labels = copyLabels(d.Labels)
+	tmp.Addresses = copyAddresses(d.AllAddresses())
+
+	select {
+	case h.group.eventQueue() <- event{explorer: h.explorer, kind: kind, discovery: &tmp}:
+	case <-h.ctx.Done():
+	}
+}
+
+// Stopped tells the group that a streaming explorer stopped, whether it was
+// dropped from the group or its Stream returned. The peers it reported are
+// removed once the events it sent before have been applied. While the queue of
+// the group is full it blocks until ctx is done, and then removes the peers
+// right away: nothing may drain the queue of a removed group.
+func (g *Group) Stopped(ctx context.Context, e explorer.Explorer) {
+	stop := event{explorer: e, kind: eventStopped}
+	select {
+	case g.eventQueue() <- stop:
+		return
+	default:
+	}
+
+	select {
+	case g.eventQueue() <- stop:
+	case <-ctx.Done():
+		g.stopped(e)
+	}
+}
+
+func (g *Group) eventQueue() chan event {
+	g.statusMu.Lock()
+	defer g.statusMu.Unlock()
+
+	if g.events == nil {
+		g.events = make(chan event, 128)
+	}
+
+	return g.events
+}
+
+// applyEvents records the event and every other one already queued, so that a
+// burst of changes is reconciled at once.
+func (g *Group) applyEvents(first event, events chan event) {
+	g.applyEvent(first)
+
+	for {
+		select {
+		case ev := <-events:
+			g.applyEvent(ev)
+		default:
+			return
+		}
+	}
+}
+
+func (g *Group) applyEvent(ev event) {
+	if ev.kind == eventStopped {
+		g.stopped(ev.explorer)
+		return
+	}
+
+	idx := slices.Index(g.Explorers, ev.explorer)
+	if idx < 0 {
+		return
+	}
+
+	name := g.sourceName(idx)
+	switch ev.kind {
+	case eventAdded, eventUpdated:
+		g.discovered(source{name: name, streamer: ev.explorer}, ev.discovery)
+	case eventRemoved:
+		g.removed(name, ev.discovery)
+	}
+}
+
+// removed marks what the source reported about a peer as gone. The peer is
+// reconciled like one whose sources expired.
+func (g *Group) removed(sourceName string, d *explorer.Discovery) {
+	key := sourceKey(sourceName, d)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if p := g.peerIndex().bySource(key); p != nil {
+		g.state[p].sources[key].removed = true
+		return
+	}
+
+	log.Debugf("explorer '%s' of group '%s' removed unknown peer %s", sourceName, g.Name, d.ID)
+}
+
+// stopped marks everything a streaming explorer reported as gone.
+func (g *Group) stopped(e explorer.Explorer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, p := range g.peerIndex().streamedBy(e) {
+		for _, s := range g.state[p].sources {
+			if s.streamer == e {
+				s.removed = true
+			}
+		}
+	}
+}
+
+func (g *Group) streaming(idx int) bool {
+	_, ok := g.Explorers[idx].(explorer.Streamer)
+	return ok
+}
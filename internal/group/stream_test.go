@@ -0,0 +1,138 @@
+package group
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ravenix/peerd/internal/peer"
+	"github.com/ravenix/peerd/pkg/explorer"
+	"github.com/ravenix/peerd/pkg/handler"
+)
+
+type streamExplorer struct {
+	testExplorer
+}
+
+func (e *streamExplorer) Stream(ctx context.Context, events explorer.EventHandler) error {
+	<-ctx.Done()
+	return nil
+}
+
+type notifyingHandler struct {
+	testHandler
+	newPeers  chan *peer.Peer
+	lostPeers chan *peer.Peer
+}
+
+func (h *notifyingHandler) NewPeer(ctx context.Context, p *peer.Peer) error {
+	h.newPeers <- p
+	return nil
+}
+
+func (h *notifyingHandler) LostPeer(ctx context.Context, p *peer.Peer) error {
+	h.lostPeers <- p
+	return nil
+}
+
+func TestStreamedPeersStayUntilRemoved(t *testing.T) {
+	e := &streamExplorer{}
+	g := &Group{
+		Name:          "test",
+		Explorers:     []explorer.Explorer{e},
+		ExplorerNames: []string{"test:stream"},
+	}
+	d := &explorer.Discovery{ID: "a", IPv4Addr: net.ParseIP("10.0.0.1")}
+
+	g.applyEvent(event{explorer: e, kind: eventAdded, discovery: d})
+	if _, newPeers, _ := g.Reconcile(context.Background(), time.Millisecond); len(newPeers) != 1 {
+		t.Fatalf("expected one new peer, got %v", newPeers)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if peers, _, lostPeers := g.Reconcile(context.Background(), time.Millisecond); len(peers) != 1 || len(lostPeers) != 0 {
+		t.Fatalf("expected streamed peer not to expire, got %v and %v", peers, lostPeers)
+	}
+
+	g.applyEvent(event{explorer: e, kind: eventRemoved, discovery: d})
+	if _, _, lostPeers := g.Reconcile(context.Background(), time.Hour); len(lostPeers) != 1 || lostPeers[0].ID != "a" {
+		t.Fatalf("expected removed peer to be lost, got %v", lostPeers)
+	}
+}
+
+func TestRunReconcilesStreamedEvents(t *testing.T) {
+	e := &streamExplorer{}
+	h := &notifyingHandler{newPeers: make(chan *peer.Peer, 1), lostPeers: make(chan *peer.Peer, 1)}
+	g := &Group{
+		Name:            "test",
+		Explorers:       []explorer.Explorer{e},
+		Handlers:        []handler.Handler{h},
+		CadenceOverride: explorer.Cadence{ExploreInterval: time.Hour},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		g.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	events := g.Events(ctx, e)
+	d := &explorer.Discovery{ID: "a", IPv4Addr: net.ParseIP("10.0.0.1")}
+
+	events.Added(d)
+	select {
+	case p := <-h.newPeers:
+		if p.ID != "a" || len(p.Sources) != 1 {
+			t.Fatalf("unexpected new peer: %+v", p)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected added peer to be announced right away")
+	}
+
+	events.Removed(d)
+	select {
+	case p := <-h.lostPeers:
+		if p.ID != "a" {
+			t.Fatalf("unexpected lost peer: %+v", p)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected removed peer to be lost right away")
+	}
+}
+
+func TestStoppedStreamLosesItsPeers(t *testing.T) {
+	e := &streamExplorer{}
+	other := &streamExplorer{}
+	g := &Group{
+		Name:          "test",
+		Explorers:     []explorer.Explorer{e, other},
+		ExplorerNames: []string{"test:stream", "test:other"},
+	}
+
+	g.applyEvent(event{explorer: e, kind: eventAdded, discovery: &explorer.Discovery{ID: "a", IPv4Addr: net.ParseIP("10.0.0.1")}})
+	g.applyEvent(event{explorer: other, kind: eventAdded, discovery: &explorer.Discovery{ID: "b", IPv4Addr: net.ParseIP("10.0.0.2")}})
+	if _, newPeers, _ := g.Reconcile(context.Background(), time.Hour); len(newPeers) != 2 {
+		t.Fatalf("expected two new peers, got %v", newPeers)
+	}
+
+	// The explorer is dropped from the group before it reports having stopped.
+	g.Explorers = []explorer.Explorer{other}
+	g.ExplorerNames = []string{"test:other"}
+	g.Stopped(context.Background(), e)
+	g.applyEvents(<-g.eventQueue(), g.eventQueue())
+
+	peers, _, lostPeers := g.Reconcile(context.Background(), time.Hour)
+	if len(lostPeers) != 1 || lostPeers[0].ID != "a" {
+		t.Fatalf("expected peer of stopped explorer to be lost, got %v", lostPeers)
+	}
+
+	if len(peers) != 1 || peers[0].ID != "b" {
+		t.Fatalf("expected peer of other explorer to stay, got %v", peers)
+	}
+}
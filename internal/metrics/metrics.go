@@ -0,0 +1,178 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "peerd"
+
+var (
+	registry = prometheus.NewRegistry()
+
+	groupPeers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "group_peers",
+		Help:      "Number of peers currently known per group.",
+	}, []string{"group"})
+
+	groupNewPeers = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "group_new_peers_total",
+		Help:      "Number of peers reported as new per group.",
+	}, []string{"group"})
+
+	groupLostPeers = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "group_lost_peers_total",
+		Help:      "Number of peers reported as lost per group.",
+	}, []string{"group"})
+
+	exploreDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "explore_duration_seconds",
+		Help:      "Duration of explorer runs.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"group", "explorer"})
+
+	exploreErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "explore_errors_total",
+		Help:      "Number of failed explorer runs.",
+	}, []string{"group", "explorer"})
+
+	hookDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "handler_hook_duration_seconds",
+		Help:      "Duration of handler hook calls.",
+		Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"group", "handler", "hook"})
+
+	hookFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "handler_hook_failures_total",
+		Help:      "Number of failed handler hook calls.",
+	}, []string{"group", "handler", "hook"})
+
+	handlerPending = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "handler_pending_deliveries",
+		Help:      "Number of new-peer and lost-peer calls waiting to be delivered to a handler again.",
+	}, []string{"group", "handler"})
+
+	handlerDegraded = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "handler_degraded",
+		Help:      "Whether a handler marked its group as degraded.",
+	}, []string{"group", "handler"})
+
+	lastSuccess = &lastSuccessCollector{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "group", "seconds_since_last_successful_cycle"),
+			"Seconds since the last exploration cycle of a group that completed without explorer errors.",
+			[]string{"group"},
+			nil,
+		),
+		groups: make(map[string]time.Time),
+	}
+)
+
+type lastSuccessCollector struct {
+	desc *prometheus.Desc
+
+	mu     sync.Mutex
+	groups map[string]time.Time
+}
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		groupPeers,
+		groupNewPeers,
+		groupLostPeers,
+		exploreDuration,
+		exploreErrors,
+		hookDuration,
+		hookFailures,
+		handlerPending,
+		handlerDegraded,
+		lastSuccess,
+	)
+}
+
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+func ObserveExplore(group string, explorer string, duration time.Duration, err error) {
+	exploreDuration.WithLabelValues(group, explorer).Observe(duration.Seconds())
+	if err != nil {
+		exploreErrors.WithLabelValues(group, explorer).Inc()
+	}
+}
+
+func ObserveHook(group string, handler string, hook string, duration time.Duration, err error) {
+	hookDuration.WithLabelValues(group, handler, hook).Observe(duration.Seconds())
+	if err != nil {
+		hookFailures.WithLabelValues(group, handler, hook).Inc()
+	}
+}
+
+func ObserveHandler(group string, handler string, pending int, degraded bool) {
+	handlerPending.WithLabelValues(group, handler).Set(float64(pending))
+
+	value := 0.0
+	if degraded {
+		value = 1
+	}
+	handlerDegraded.WithLabelValues(group, handler).Set(value)
+}
+
+func ObserveCycle(group string, peers int, newPeers int, lostPeers int, successful bool) {
+	groupPeers.WithLabelValues(group).Set(float64(peers))
+	groupNewPeers.WithLabelValues(group).Add(float64(newPeers))
+	groupLostPeers.WithLabelValues(group).Add(float64(lostPeers))
+
+	if successful {
+		lastSuccess.mu.Lock()
+		lastSuccess.groups[group] = time.Now()
+		lastSuccess.mu.Unlock()
+	}
+}
+
+func ForgetGroup(group string) {
+	labels := prometheus.Labels{"group": group}
+	groupPeers.DeletePartialMatch(labels)
+	groupNewPeers.DeletePartialMatch(labels)
+	groupLostPeers.DeletePartialMatch(labels)
+	exploreDuration.DeletePartialMatch(labels)
+	exploreErrors.DeletePartialMatch(labels)
+	hookDuration.DeletePartialMatch(labels)
+	hookFailures.DeletePartialMatch(labels)
+	handlerPending.DeletePartialMatch(labels)
+	handlerDegraded.DeletePartialMatch(labels)
+
+	lastSuccess.mu.Lock()
+	delete(lastSuccess.groups, group)
+	lastSuccess.mu.Unlock()
+}
+
+func (c *lastSuccessCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *lastSuccessCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for group, last := range c.groups {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, now.Sub(last).Seconds(), group)
+	}
+}
@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func scrape(t *testing.T) string {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: %d", rec.Code)
+	}
+
+	return rec.Body.String()
+}
+
+func TestMetricsExposeGroupCounters(t *testing.T) {
+	ObserveCycle("metrics-test", 3, 2, 1, true)
+	ObserveExplore("metrics-test", "kubernetes:node", 20*time.Millisecond, errors.New("list failed"))
+	ObserveHook("metrics-test", "exec:command", "new_peer", time.Millisecond, errors.New("exit status 1"))
+
+	body := scrape(t)
+	for _, expected := range []string{
+		`peerd_group_peers{group="metrics-test"} 3`,
+		`peerd_group_new_peers_total{group="metrics-test"} 2`,
+		`peerd_group_lost_peers_total{group="metrics-test"} 1`,
+		`peerd_explore_errors_total{explorer="kubernetes:node",group="metrics-test"} 1`,
+		`peerd_handler_hook_failures_total{group="metrics-test",handler="exec:command",hook="new_peer"} 1`,
+		`peerd_group_seconds_since_last_successful_cycle{group="metrics-test"}`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Fatalf("expected metrics to contain %q", expected)
+		}
+	}
+
+	ForgetGroup("metrics-test")
+	if strings.Contains(scrape(t), `group="metrics-test"`) {
+		t.Fatalf("expected metrics of forgotten group to be removed")
+	}
+}
@@ -0,0 +1,63 @@
+package peer
+
+import (
+	"net"
+)
+
+type Family string
+
+const (
+	FamilyIPv4 Family = "ipv4"
+	FamilyIPv6 Family = "ipv6"
+)
+
+type Address struct {
+	IP     net.IP `json:"ip"`
+	Family Family `json:"family"`
+	Scope  string `json:"scope,omitempty"`
+	Label  string `json:"label,omitempty"`
+}
+
+func NewAddress(ip net.IP) Address {
+	if ipv4 := ip.To4(); ipv4 != nil {
+		return Address{IP: ipv4, Family: FamilyIPv4}
+	}
+
+	return Address{IP: ip, Family: FamilyIPv6}
+}
+
+func (a Address) String() string {
+	return a.IP.String()
+}
+
+func FilterAddresses(addresses []Address, family Family) []Address {
+	var tmp []Address
+	for _, a := range addresses {
+		if a.Family == family {
+			tmp = append(tmp, a)
+		}
+	}
+	return tmp
+}
+
+func SameAddresses(a []Address, b []Address) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for _, addrA := range a {
+		found := false
+		for _, addrB := range b {
+			if addrA.IP.Equal(addrB.IP) && addrA.Scope == addrB.Scope && addrA.Label == addrB.Label {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
@@ -6,10 +6,17 @@ import (
 )
 
 type Peer struct {
-	IPv4Addr net.IP
-	IPv6Addr net.IP
-	Port     uint16
+	ID     string            `json:"id,omitempty"`
+	Name   string            `json:"name,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
 
-	FirstSeen time.Time
-	LastSeen  time.Time
+	IPv4Addr  net.IP    `json:"ipv4_addr,omitempty"`
+	IPv6Addr  net.IP    `json:"ipv6_addr,omitempty"`
+	Addresses []Address `json:"addresses,omitempty"`
+	Port      uint16    `json:"port"`
+
+	Sources []string `json:"sources,omitempty"`
+
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
 }
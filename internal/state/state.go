@@ -0,0 +1,105 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ravenix/peerd/internal/peer"
+)
+
+const version = 1
+
+// Store keeps one snapshot file per group in a directory.
+type Store struct {
+	dir string
+}
+
+type snapshot struct {
+	Version int          `json:"version"`
+	Group   string       `json:"group"`
+	Saved   time.Time    `json:"saved"`
+	Peers   []*peer.Peer `json:"peers"`
+}
+
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	return &Store{dir: dir}, nil
+}
+
+// Load returns the peers last saved for the group, or none if the group has
+// not been saved yet.
+func (s *Store) Load(group string) ([]*peer.Peer, error) {
+	contents, err := os.ReadFile(s.filename(group))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(contents, &snap); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", s.filename(group), err)
+	}
+
+	if snap.Version != version {
+		return nil, fmt.Errorf("unsupported state version %d in %s", snap.Version, s.filename(group))
+	}
+
+	return snap.Peers, nil
+}
+
+// Save replaces the snapshot of the group. The file is written next to the
+// previous one and renamed over it, so readers never see a partial snapshot.
+func (s *Store) Save(group string, peers []*peer.Peer) error {
+	contents, err := json.Marshal(&snapshot{
+		Version: version,
+		Group:   group,
+		Saved:   time.Now(),
+		Peers:   peers,
+	})
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(s.dir, ".snapshot-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(contents); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), s.filename(group))
+}
+
+func (s *Store) Remove(group string) error {
+	if err := os.Remove(s.filename(group)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Store) filename(group string) string {
+	return filepath.Join(s.dir, url.PathEscape(group)+".json")
+}
@@ -0,0 +1,63 @@
+package state
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ravenix/peerd/internal/peer"
+)
+
+func TestSaveAndLoad(t *testing.T) {
+	s, err := NewStore(filepath.Join(t.TempDir(), "state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if peers, err := s.Load("bgp/routers"); err != nil || peers != nil {
+		t.Fatalf("expected nothing for an unsaved group, got %v, %v", peers, err)
+	}
+
+	firstSeen := time.Now().Add(-time.Hour).Truncate(time.Second)
+	err = s.Save("bgp/routers", []*peer.Peer{{
+		ID:        "node/a",
+		Name:      "a",
+		Labels:    map[string]string{"zone": "a"},
+		IPv4Addr:  net.ParseIP("10.0.0.1").To4(),
+		Addresses: []peer.Address{peer.NewAddress(net.ParseIP("10.0.0.1"))},
+		Port:      179,
+		FirstSeen: firstSeen,
+		LastSeen:  firstSeen.Add(time.Minute),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil || len(entries) != 1 || entries[0].Name() != "bgp%2Frouters.json" {
+		t.Fatalf("expected a single snapshot file, got %v, %v", entries, err)
+	}
+
+	peers, err := s.Load("bgp/routers")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(peers) != 1 || peers[0].ID != "node/a" || peers[0].Labels["zone"] != "a" || peers[0].Port != 179 {
+		t.Fatalf("unexpected peers: %+v", peers)
+	}
+
+	if !peers[0].IPv4Addr.Equal(net.ParseIP("10.0.0.1")) || !peers[0].FirstSeen.Equal(firstSeen) || len(peers[0].Addresses) != 1 {
+		t.Fatalf("unexpected peer: %+v", peers[0])
+	}
+
+	if err := s.Remove("bgp/routers"); err != nil {
+		t.Fatal(err)
+	}
+
+	if peers, err := s.Load("bgp/routers"); err != nil || peers != nil {
+		t.Fatalf("expected nothing after removal, got %v, %v", peers, err)
+	}
+}
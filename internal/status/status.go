@@ -0,0 +1,171 @@
+package status
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/ravenix/peerd/internal/group"
+	"github.com/ravenix/peerd/internal/peer"
+	log "github.com/sirupsen/logrus"
+)
+
+type Provider interface {
+	Status() []group.Status
+}
+
+type groupView struct {
+	Name      string          `json:"name"`
+	Degraded  bool            `json:"degraded"`
+	Cadence   cadenceView     `json:"cadence"`
+	Peers     []*peer.Peer    `json:"peers"`
+	Damping   []dampingView   `json:"damping"`
+	LastCycle *cycleView      `json:"last_cycle,omitempty"`
+	Explorers []componentView `json:"explorers"`
+	Handlers  []componentView `json:"handlers"`
+}
+
+type cadenceView struct {
+	ExploreInterval string `json:"explore_interval"`
+	ExploreTimeout  string `json:"explore_timeout"`
+	PeerTTL         string `json:"peer_ttl"`
+}
+
+type cycleView struct {
+	Started   time.Time    `json:"started"`
+	Duration  string       `json:"duration"`
+	NewPeers  []*peer.Peer `json:"new_peers"`
+	LostPeers []*peer.Peer `json:"lost_peers"`
+}
+
+type dampingView struct {
+	Peer    *peer.Peer `json:"peer"`
+	State   string     `json:"state"`
+	Cycles  int        `json:"cycles"`
+	Since   *time.Time `json:"since,omitempty"`
+	Penalty float64    `json:"penalty"`
+}
+
+type componentView struct {
+	Name     string              `json:"name"`
+	Calls    map[string]callView `json:"calls"`
+	Pending  int                 `json:"pending,omitempty"`
+	Degraded bool                `json:"degraded,omitempty"`
+}
+
+type callView struct {
+	Started  time.Time `json:"started"`
+	Duration string    `json:"duration"`
+	Error    string    `json:"error,omitempty"`
+}
+
+func Register(mux *http.ServeMux, provider Provider) {
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		views := make([]groupView, 0)
+		for _, s := range provider.Status() {
+			views = append(views, newGroupView(s))
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{"groups": views})
+	})
+
+	mux.HandleFunc("GET /status/{group}", func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("group")
+		for _, s := range provider.Status() {
+			if s.Name == name {
+				writeJSON(w, http.StatusOK, newGroupView(s))
+				return
+			}
+		}
+
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "group '" + name + "' does not exist"})
+	})
+}
+
+func newGroupView(s group.Status) groupView {
+	view := groupView{
+		Name:     s.Name,
+		Degraded: s.Degraded,
+		Cadence: cadenceView{
+			ExploreInterval: s.Cadence.ExploreInterval.String(),
+			ExploreTimeout:  s.Cadence.ExploreTimeout.String(),
+			PeerTTL:         s.Cadence.PeerTTL.String(),
+		},
+		Peers:     nonNilPeers(s.Peers),
+		Damping:   newDampingViews(s.Damping),
+		Explorers: newComponentViews(s.Explorers),
+		Handlers:  newComponentViews(s.Handlers),
+	}
+
+	if s.LastCycle != nil {
+		view.LastCycle = &cycleView{
+			Started:   s.LastCycle.Started,
+			Duration:  s.LastCycle.Duration.String(),
+			NewPeers:  nonNilPeers(s.LastCycle.NewPeers),
+			LostPeers: nonNilPeers(s.LastCycle.LostPeers),
+		}
+	}
+
+	return view
+}
+
+func newDampingViews(statuses []group.DampingStatus) []dampingView {
+	views := make([]dampingView, 0, len(statuses))
+	for _, d := range statuses {
+		view := dampingView{
+			Peer:    d.Peer,
+			State:   d.State,
+			Cycles:  d.Cycles,
+			Penalty: d.Penalty,
+		}
+
+		if !d.Since.IsZero() {
+			since := d.Since
+			view.Since = &since
+		}
+
+		views = append(views, view)
+	}
+
+	return views
+}
+
+func newComponentViews(components []group.ComponentStatus) []componentView {
+	views := make([]componentView, 0, len(components))
+	for _, c := range components {
+		calls := make(map[string]callView, len(c.Calls))
+		for hook, call := range c.Calls {
+			calls[hook] = callView{
+				Started:  call.Started,
+				Duration: call.Duration.String(),
+				Error:    call.Error,
+			}
+		}
+
+		views = append(views, componentView{
+			Name:     c.Name,
+			Calls:    calls,
+			Pending:  c.Pending,
+			Degraded: c.Degraded,
+		})
+	}
+
+	return views
+}
+
+func nonNilPeers(peers []*peer.Peer) []*peer.Peer {
+	if peers == nil {
+		return []*peer.Peer{}
+	}
+
+	return peers
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Debugf("Failed writing status response: %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package status
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ravenix/peerd/internal/group"
+	"github.com/ravenix/peerd/internal/peer"
+	"github.com/ravenix/peerd/pkg/explorer"
+)
+
+type testProvider []group.Status
+
+func (p testProvider) Status() []group.Status { return p }
+
+func TestStatusListsGroups(t *testing.T) {
+	mux := http.NewServeMux()
+	Register(mux, testProvider{{
+		Name: "edge",
+		Cadence: explorer.Cadence{
+			ExploreInterval: 2 * time.Second,
+			ExploreTimeout:  time.Second,
+			PeerTTL:         6 * time.Second,
+		},
+		Peers: []*peer.Peer{{IPv6Addr: net.ParseIP("fd00::1"), Port: 179}},
+		Explorers: []group.ComponentStatus{{
+			Name:  "multicast:dns",
+			Calls: map[string]group.CallStatus{group.HookExplore: {Duration: time.Second, Error: "timeout"}},
+		}},
+	}})
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: %d", rec.Code)
+	}
+
+	var body struct {
+		Groups []groupView `json:"groups"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("unexpected error decoding response: %v", err)
+	}
+
+	if len(body.Groups) != 1 || body.Groups[0].Cadence.PeerTTL != "6s" || len(body.Groups[0].Peers) != 1 {
+		t.Fatalf("unexpected response: %s", rec.Body.String())
+	}
+
+	if body.Groups[0].Explorers[0].Calls[group.HookExplore].Error != "timeout" {
+		t.Fatalf("expected explorer error in response: %s", rec.Body.String())
+	}
+}
+
+func TestStatusReturnsNotFoundForUnknownGroup(t *testing.T) {
+	mux := http.NewServeMux()
+	Register(mux, testProvider{{Name: "edge"}})
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status/core", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("unexpected status code: %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status/edge", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: %d", rec.Code)
+	}
+}
@@ -0,0 +1,154 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ravenix/peerd/internal/config"
+	"github.com/ravenix/peerd/internal/group"
+	"github.com/ravenix/peerd/pkg/explorer"
+)
+
+const (
+	sectionCadence  = "cadence"
+	sectionMerge    = "merge"
+	sectionDamping  = "damping"
+	sectionExplorer = "explorer"
+	sectionHandler  = "handler"
+)
+
+// settings are the parts of a group configuration which are taken care of by
+// the core rather than by plugins.
+type settings struct {
+	cadence          explorer.Cadence
+	explorerCadences []explorer.Cadence
+	merge            group.MergePolicy
+	damping          group.Damping
+	policies         []group.HandlerPolicy
+	deps             [][]int
+}
+
+// SettingsError is a problem with the settings of a group. It is located in
+// Section, and for explorers and handlers at the entry with the Index.
+type SettingsError struct {
+	Section string
+	Index   int
+	Err     error
+}
+
+func (e *SettingsError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *SettingsError) Unwrap() error {
+	return e.Err
+}
+
+// Position returns the line and column of the configuration the error is
+// about.
+func (e *SettingsError) Position(cg *config.Group) (int, int) {
+	switch e.Section {
+	case sectionCadence:
+		return cg.Cadence.Line, cg.Cadence.Column
+	case sectionMerge:
+		return cg.Merge.Line, cg.Merge.Column
+	case sectionDamping:
+		return cg.Damping.Line, cg.Damping.Column
+	case sectionExplorer:
+		ce := &cg.Explorers[e.Index]
+		if ce.Cadence.Line > 0 {
+			return ce.Cadence.Line, ce.Cadence.Column
+		}
+		return ce.Line, ce.Column
+	case sectionHandler:
+		return cg.Handlers[e.Index].Line, cg.Handlers[e.Index].Column
+	}
+
+	return 0, 0
+}
+
+// ValidateGroup checks the settings of a group which are not handled by
+// plugins. Problems are reported as a SettingsError.
+func ValidateGroup(cg *config.Group) error {
+	_, err := newSettings(cg)
+	return err
+}
+
+func newSettings(cg *config.Group) (*settings, error) {
+	cadence := newCadence(&cg.Cadence)
+	if err := cadence.Validate(); err != nil {
+		return nil, &SettingsError{Section: sectionCadence, Err: fmt.Errorf("cadence: %w", err)}
+	}
+
+	explorerCadences := make([]explorer.Cadence, len(cg.Explorers))
+	for idx := range cg.Explorers {
+		ce := &cg.Explorers[idx]
+		explorerCadences[idx] = newCadence(&ce.Cadence)
+		if err := explorerCadences[idx].Validate(); err != nil {
+			return nil, &SettingsError{Section: sectionExplorer, Index: idx, Err: fmt.Errorf("explorer '%s' cadence: %w", ce.Name, err)}
+		}
+	}
+
+	merge, err := group.NewMergePolicy(cg.Merge.Match, cg.Merge.Label)
+	if err != nil {
+		return nil, &SettingsError{Section: sectionMerge, Err: fmt.Errorf("merge: %w", err)}
+	}
+
+	damping := group.Damping{
+		UpCycles:          cg.Damping.UpCycles,
+		DownCycles:        cg.Damping.DownCycles,
+		DownAfter:         cg.Damping.DownAfter,
+		FlapPenalty:       cg.Damping.FlapPenalty,
+		HalfLife:          cg.Damping.HalfLife,
+		SuppressThreshold: cg.Damping.SuppressThreshold,
+		ReuseThreshold:    cg.Damping.ReuseThreshold,
+	}
+	if err := damping.Validate(); err != nil {
+		return nil, &SettingsError{Section: sectionDamping, Err: fmt.Errorf("damping: %w", err)}
+	}
+
+	ids := make([]string, len(cg.Handlers))
+	names := make([]string, len(cg.Handlers))
+	after := make([][]string, len(cg.Handlers))
+	policies := make([]group.HandlerPolicy, len(cg.Handlers))
+	for idx := range cg.Handlers {
+		ch := &cg.Handlers[idx]
+		ids[idx], names[idx], after[idx] = ch.ID, ch.Name, ch.After
+
+		policies[idx] = group.HandlerPolicy{
+			Timeout:   ch.Timeout,
+			Retries:   ch.Retries,
+			Backoff:   ch.Backoff,
+			OnFailure: ch.OnFailure,
+		}
+		if err := policies[idx].Validate(); err != nil {
+			return nil, &SettingsError{Section: sectionHandler, Index: idx, Err: fmt.Errorf("handler '%s': %w", ch.Name, err)}
+		}
+	}
+
+	deps, err := group.ResolveDependencies(ids, names, after)
+	if err != nil {
+		var depErr *group.DependencyError
+		if errors.As(err, &depErr) {
+			return nil, &SettingsError{Section: sectionHandler, Index: depErr.Index, Err: err}
+		}
+		return nil, err
+	}
+
+	return &settings{
+		cadence:          cadence,
+		explorerCadences: explorerCadences,
+		merge:            merge,
+		damping:          damping,
+		policies:         policies,
+		deps:             deps,
+	}, nil
+}
+
+func newCadence(cc *config.Cadence) explorer.Cadence {
+	return explorer.Cadence{
+		ExploreInterval: cc.Interval,
+		ExploreTimeout:  cc.Timeout,
+		PeerTTL:         cc.PeerTTL,
+	}
+}
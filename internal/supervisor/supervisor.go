@@ -0,0 +1,492 @@
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/ravenix/peerd/internal/config"
+	"github.com/ravenix/peerd/internal/group"
+	"github.com/ravenix/peerd/internal/metrics"
+	"github.com/ravenix/peerd/internal/state"
+	"github.com/ravenix/peerd/pkg/explorer"
+	"github.com/ravenix/peerd/pkg/handler"
+	"github.com/ravenix/peerd/pkg/plugin"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+type Supervisor struct {
+	ctx   context.Context
+	store *state.Store
+
+	mu     sync.Mutex
+	groups map[string]*runningGroup
+
+	loopsWg     sync.WaitGroup
+	explorersWg sync.WaitGroup
+
+	failed chan error
+}
+
+type runningGroup struct {
+	group     *group.Group
+	explorers []*runningExplorer
+	handlers  []*runningHandler
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+type runningExplorer struct {
+	name        string
+	fingerprint string
+	explorer    explorer.Explorer
+
+	cancel context.CancelFunc
+}
+
+type runningHandler struct {
+	name        string
+	fingerprint string
+	handler     handler.Handler
+	policy      group.HandlerPolicy
+}
+
+type groupPlan struct {
+	name      string
+	current   *runningGroup
+	settings  *settings
+	explorers []*runningExplorer
+	handlers  []*runningHandler
+	removed   []*runningHandler
+	changed   bool
+
+	// initialized are the explorers and handlers created for the plan.
+	initialized []any
+}
+
+// New creates a supervisor. With a store, the peers of each group are saved
+// after every cycle and restored when the group is started.
+func New(ctx context.Context, store *state.Store) *Supervisor {
+	return &Supervisor{
+		ctx:    ctx,
+		store:  store,
+		groups: make(map[string]*runningGroup),
+		failed: make(chan error, 1),
+	}
+}
+
+// Failed reports the failure of a handler which asked for peerd to exit. The
+// caller is expected to shut the supervisor down.
+func (s *Supervisor) Failed() <-chan error {
+	return s.failed
+}
+
+func (s *Supervisor) fail(err error) {
+	select {
+	case s.failed <- err:
+	default:
+	}
+}
+
+func (s *Supervisor) Apply(cfg *config.Config) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	plans := make([]*groupPlan, 0, len(cfg.Groups))
+	for cgn, cg := range cfg.Groups {
+		plan, err := s.planGroup(cgn, &cg)
+		if err != nil {
+			for _, plan := range plans {
+				plan.release()
+			}
+			return err
+		}
+
+		plans = append(plans, plan)
+	}
+
+	for name, rg := range s.groups {
+		if _, ok := cfg.Groups[name]; ok {
+			continue
+		}
+
+		log.Infof("Removing group '%s'", name)
+		s.stopLoop(rg)
+		for _, re := range rg.explorers {
+			re.cancel()
+		}
+		rg.group.Shutdown(s.ctx)
+		metrics.ForgetGroup(name)
+		if s.store != nil {
+			if err := s.store.Remove(name); err != nil {
+				log.Warnf("Failed removing state of group '%s': %v", name, err)
+			}
+		}
+		delete(s.groups, name)
+	}
+
+	for _, plan := range plans {
+		if !plan.changed {
+			continue
+		}
+
+		if plan.current != nil {
+			log.Infof("Reloading group '%s'", plan.name)
+			s.stopLoop(plan.current)
+			retainExplorers(plan.current.explorers, plan.explorers)
+			shutdownHandlers(s.ctx, plan.current.group, plan.removed)
+		} else {
+			log.Infof("Adding group '%s'", plan.name)
+			plan.current = &runningGroup{
+				group: &group.Group{Name: plan.name, Exit: s.fail},
+			}
+
+			if s.store != nil {
+				plan.current.group.Store = s.store
+				if err := plan.current.group.Restore(cfg.State.GracePeriod); err != nil {
+					log.Warnf("Could not restore state of group '%s': %v", plan.name, err)
+				}
+			}
+		}
+
+		rg := plan.current
+		rg.explorers = plan.explorers
+		rg.handlers = plan.handlers
+		rg.group.CadenceOverride = plan.settings.cadence
+		rg.group.ExplorerCadenceOverrides = plan.settings.explorerCadences
+		rg.group.Merge = plan.settings.merge
+		rg.group.Damping = plan.settings.damping
+		rg.group.Explorers = nil
+		rg.group.ExplorerNames = nil
+		rg.group.Handlers = nil
+		rg.group.HandlerNames = nil
+		rg.group.HandlerPolicies = nil
+		rg.group.HandlerDependencies = plan.settings.deps
+
+		for _, re := range rg.explorers {
+			if re.cancel == nil {
+				s.startExplorer(rg.group, re)
+			}
+			rg.group.Explorers = append(rg.group.Explorers, re.explorer)
+			rg.group.ExplorerNames = append(rg.group.ExplorerNames, re.name)
+		}
+
+		for _, rh := range rg.handlers {
+			rg.group.Handlers = append(rg.group.Handlers, rh.handler)
+			rg.group.HandlerNames = append(rg.group.HandlerNames, rh.name)
+			rg.group.HandlerPolicies = append(rg.group.HandlerPolicies, rh.policy)
+		}
+
+		s.groups[plan.name] = rg
+		s.startLoop(rg)
+	}
+
+	return nil
+}
+
+func (s *Supervisor) Shutdown(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, rg := range s.groups {
+		rg.cancel()
+		for _, re := range rg.explorers {
+			re.cancel()
+		}
+	}
+
+	if !waitTimeout(ctx, &s.loopsWg) {
+		log.Warnf("Timed out waiting for running cycles to finish")
+	}
+
+	for _, rg := range s.groups {
+		rg.group.Shutdown(ctx)
+	}
+
+	if !waitTimeout(ctx, &s.explorersWg) {
+		log.Warnf("Timed out waiting for explorers to stop")
+	}
+}
+
+// Status reports every group. The lock is held throughout, since Apply
+// reconfigures the groups it keeps.
+func (s *Supervisor) Status() []group.Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	groups := make([]*group.Group, 0, len(s.groups))
+	for _, rg := range s.groups {
+		groups = append(groups, rg.group)
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
+	})
+
+	statuses := make([]group.Status, 0, len(groups))
+	for _, g := range groups {
+		statuses = append(statuses, g.Status())
+	}
+
+	return statuses
+}
+
+func (s *Supervisor) planGroup(name string, cg *config.Group) (*groupPlan, error) {
+	plan := &groupPlan{
+		name:    name,
+		current: s.groups[name],
+	}
+
+	settings, err := newSettings(cg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration for group '%s': %w", name, err)
+	}
+	plan.settings = settings
+
+	var oldExplorers []*runningExplorer
+	var oldHandlers []*runningHandler
+	if plan.current != nil {
+		oldExplorers = append(oldExplorers, plan.current.explorers...)
+		oldHandlers = append(oldHandlers, plan.current.handlers...)
+	}
+
+	for idx := range cg.Explorers {
+		ce := &cg.Explorers[idx]
+		fp := fingerprint(ce.Name, &ce.Configuration)
+
+		if reused := takeExplorer(&oldExplorers, fp); reused != nil {
+			plan.explorers = append(plan.explorers, reused)
+			continue
+		}
+
+		e, err := plugin.InitializeExplorer(ce.Name, &ce.Configuration)
+		if err != nil {
+			plan.release()
+			return nil, fmt.Errorf("could not initialize explorer '%s' for group '%s': %w", ce.Name, name, err)
+		}
+
+		plan.explorers = append(plan.explorers, &runningExplorer{
+			name:        ce.Name,
+			fingerprint: fp,
+			explorer:    e,
+		})
+		plan.initialized = append(plan.initialized, e)
+	}
+
+	for idx := range cg.Handlers {
+		ch := &cg.Handlers[idx]
+		fp := fingerprint(ch.Name, &ch.Configuration)
+		policy := settings.policies[idx]
+
+		// Handlers are known by their ID, which tells apart the handlers of
+		// one plugin.
+		handlerName := ch.Name
+		if ch.ID != "" {
+			handlerName = ch.ID
+		}
+
+		if reused := takeHandler(&oldHandlers, fp); reused != nil {
+			if reused.policy != policy || reused.name != handlerName {
+				reused = &runningHandler{
+					name:        handlerName,
+					fingerprint: reused.fingerprint,
+					handler:     reused.handler,
+					policy:      policy,
+				}
+			}
+
+			plan.handlers = append(plan.handlers, reused)
+			continue
+		}
+
+		h, err := plugin.InitializeHandler(ch.Name, &ch.Configuration)
+		if err != nil {
+			plan.release()
+			return nil, fmt.Errorf("could not initialize handler '%s' for group '%s': %w", ch.Name, name, err)
+		}
+
+		plan.handlers = append(plan.handlers, &runningHandler{
+			name:        handlerName,
+			fingerprint: fp,
+			handler:     h,
+			policy:      policy,
+		})
+		plan.initialized = append(plan.initialized, h)
+	}
+	plan.removed = oldHandlers
+
+	plan.changed = plan.current == nil ||
+		plan.current.group.CadenceOverride != settings.cadence ||
+		!reflect.DeepEqual(plan.current.group.ExplorerCadenceOverrides, settings.explorerCadences) ||
+		plan.current.group.Merge != settings.merge ||
+		plan.current.group.Damping != settings.damping ||
+		!reflect.DeepEqual(plan.current.group.HandlerDependencies, settings.deps) ||
+		!sameExplorers(plan.current.explorers, plan.explorers) ||
+		!sameHandlers(plan.current.handlers, plan.handlers)
+
+	return plan, nil
+}
+
+// startExplorer runs the explorer until it is cancelled. A streaming explorer
+// is streamed into the group instead, which drops its peers once it stopped.
+func (s *Supervisor) startExplorer(g *group.Group, re *runningExplorer) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	re.cancel = cancel
+
+	s.explorersWg.Add(1)
+	go func() {
+		defer s.explorersWg.Done()
+
+		var err error
+		if streamer, ok := re.explorer.(explorer.Streamer); ok {
+			err = streamer.Stream(ctx, g.Events(ctx, re.explorer))
+			g.Stopped(ctx, re.explorer)
+		} else {
+			err = re.explorer.Run(ctx)
+		}
+
+		if err != nil {
+			log.Fatalf("Explorer '%s' for group '%s' could not be run: %v", reflect.TypeOf(re.explorer).String(), g.Name, err)
+		}
+	}()
+}
+
+func (s *Supervisor) startLoop(rg *runningGroup) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	rg.cancel = cancel
+	rg.done = make(chan struct{})
+
+	s.loopsWg.Add(1)
+	go func() {
+		defer s.loopsWg.Done()
+		defer close(rg.done)
+		rg.group.Run(ctx)
+	}()
+}
+
+func (s *Supervisor) stopLoop(rg *runningGroup) {
+	rg.cancel()
+	<-rg.done
+}
+
+// release closes the explorers and handlers initialized for a plan which is
+// not applied. Those holding resources from initialization on implement
+// io.Closer; the others only start holding any once they run.
+func (plan *groupPlan) release() {
+	for _, initialized := range plan.initialized {
+		if closer, ok := initialized.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				log.Warnf("Failed releasing '%s' of group '%s': %v", reflect.TypeOf(initialized).String(), plan.name, err)
+			}
+		}
+	}
+}
+
+func retainExplorers(old []*runningExplorer, retained []*runningExplorer) {
+	for _, re := range old {
+		kept := false
+		for _, r := range retained {
+			if r == re {
+				kept = true
+				break
+			}
+		}
+
+		if !kept {
+			re.cancel()
+		}
+	}
+}
+
+func sameExplorers(a []*runningExplorer, b []*runningExplorer) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for idx := range a {
+		if a[idx] != b[idx] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func sameHandlers(a []*runningHandler, b []*runningHandler) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for idx := range a {
+		if a[idx] != b[idx] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func takeExplorer(explorers *[]*runningExplorer, fp string) *runningExplorer {
+	for idx, re := range *explorers {
+		if re.fingerprint == fp {
+			*explorers = append((*explorers)[:idx], (*explorers)[idx+1:]...)
+			return re
+		}
+	}
+
+	return nil
+}
+
+// shutdownHandlers runs the shutdown hook of the handlers removed from a group
+// which keeps running.
+func shutdownHandlers(ctx context.Context, g *group.Group, removed []*runningHandler) {
+	if len(removed) == 0 {
+		return
+	}
+
+	handlers := make([]handler.Handler, 0, len(removed))
+	for _, rh := range removed {
+		handlers = append(handlers, rh.handler)
+	}
+	g.ShutdownHandlers(ctx, handlers)
+}
+
+func takeHandler(handlers *[]*runningHandler, fp string) *runningHandler {
+	for idx, rh := range *handlers {
+		if rh.fingerprint == fp {
+			*handlers = append((*handlers)[:idx], (*handlers)[idx+1:]...)
+			return rh
+		}
+	}
+
+	return nil
+}
+
+func fingerprint(name string, node *yaml.Node) string {
+	out, err := yaml.Marshal(node)
+	if err != nil {
+		return fmt.Sprintf("%s\x00%p", name, node)
+	}
+
+	return name + "\x00" + string(out)
+}
+
+func waitTimeout(ctx context.Context, wg *sync.WaitGroup) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,448 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ravenix/peerd/internal/config"
+	"github.com/ravenix/peerd/internal/peer"
+	"github.com/ravenix/peerd/pkg/explorer"
+	"github.com/ravenix/peerd/pkg/handler"
+	"github.com/ravenix/peerd/pkg/plugin"
+	"gopkg.in/yaml.v3"
+)
+
+type testExplorer struct{}
+
+func (testExplorer) Run(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (testExplorer) Explore(context.Context, explorer.DiscoveryHandler) error { return nil }
+
+func (testExplorer) Cadence() explorer.Cadence {
+	return explorer.Cadence{
+		ExploreInterval: time.Hour,
+		ExploreTimeout:  time.Millisecond,
+		PeerTTL:         time.Hour,
+	}
+}
+
+type testHandler struct{}
+
+func (testHandler) PreExploration(context.Context, []*peer.Peer) error { return nil }
+func (testHandler) NewPeer(context.Context, *peer.Peer) error          { return nil }
+func (testHandler) LostPeer(context.Context, *peer.Peer) error         { return nil }
+func (testHandler) PostExploration(context.Context, []*peer.Peer, []*peer.Peer, []*peer.Peer) error {
+	return nil
+}
+
+type streamExplorer struct {
+	testExplorer
+}
+
+func (streamExplorer) Stream(ctx context.Context, events explorer.EventHandler) error {
+	events.Added(&explorer.Discovery{ID: "streamed", IPv4Addr: net.ParseIP("10.0.0.1")})
+	<-ctx.Done()
+	return nil
+}
+
+// notifyingHandler passes new and lost peers to the channels of the test.
+type notifyingHandler struct {
+	testHandler
+}
+
+var newPeers = make(chan *peer.Peer, 8)
+var lostPeers = make(chan *peer.Peer, 8)
+
+func (notifyingHandler) NewPeer(ctx context.Context, p *peer.Peer) error {
+	newPeers <- p
+	return nil
+}
+
+func (notifyingHandler) LostPeer(ctx context.Context, p *peer.Peer) error {
+	lostPeers <- p
+	return nil
+}
+
+// shutdownHandler passes its label to shutdowns when it is shut down.
+type shutdownHandler struct {
+	testHandler
+	label string
+}
+
+var shutdowns = make(chan string, 8)
+
+func (h *shutdownHandler) Shutdown(context.Context, []*peer.Peer) error {
+	shutdowns <- h.label
+	return nil
+}
+
+// closingExplorer counts how often explorers were closed.
+type closingExplorer struct {
+	testExplorer
+}
+
+var closed atomic.Int32
+
+func (closingExplorer) Close() error {
+	closed.Add(1)
+	return nil
+}
+
+type testPluginConfig struct {
+	Fail  bool   `yaml:"fail"`
+	Label string `yaml:"label"`
+}
+
+func init() {
+	plugin.Register("supervisortest", func(api plugin.PluginApi) {
+		api.RegisterExplorer("explorer", func(node *yaml.Node) (explorer.Explorer, error) {
+			var config testPluginConfig
+			if err := plugin.DecodeConfig(node, &config); err != nil {
+				return nil, err
+			}
+
+			if config.Fail {
+				return nil, fmt.Errorf("failing as configured")
+			}
+
+			return &testExplorer{}, nil
+		})
+		api.RegisterExplorer("closing", func(*yaml.Node) (explorer.Explorer, error) {
+			return &closingExplorer{}, nil
+		})
+		api.RegisterExplorer("stream", func(*yaml.Node) (explorer.Explorer, error) {
+			return &streamExplorer{}, nil
+		})
+		api.RegisterHandler("handler", func(*yaml.Node) (handler.Handler, error) {
+			return &testHandler{}, nil
+		})
+		api.RegisterHandler("notifying", func(*yaml.Node) (handler.Handler, error) {
+			return &notifyingHandler{}, nil
+		})
+		api.RegisterHandler("shutdown", func(node *yaml.Node) (handler.Handler, error) {
+			var config testPluginConfig
+			if err := plugin.DecodeConfig(node, &config); err != nil {
+				return nil, err
+			}
+
+			return &shutdownHandler{label: config.Label}, nil
+		})
+	})
+}
+
+func mustConfig(t *testing.T, contents string) *config.Config {
+	t.Helper()
+
+	var cfg config.Config
+	if err := yaml.Unmarshal([]byte(contents), &cfg); err != nil {
+		t.Fatalf("unexpected error parsing configuration: %v", err)
+	}
+
+	return &cfg
+}
+
+func TestApplyKeepsUnchangedGroups(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := New(ctx, nil)
+	if err := s.Apply(mustConfig(t, `
+groups:
+  a:
+    explorers:
+      - name: supervisortest:explorer
+  b:
+    explorers:
+      - name: supervisortest:explorer
+        configuration:
+          fail: false
+`)); err != nil {
+		t.Fatalf("unexpected error applying configuration: %v", err)
+	}
+
+	groupA := s.groups["a"].group
+	explorerA := s.groups["a"].group.Explorers[0]
+	groupB := s.groups["b"].group
+
+	if err := s.Apply(mustConfig(t, `
+groups:
+  a:
+    explorers:
+      - name: supervisortest:explorer
+  b:
+    explorers:
+      - name: supervisortest:explorer
+    handlers:
+      - name: supervisortest:handler
+`)); err != nil {
+		t.Fatalf("unexpected error reloading configuration: %v", err)
+	}
+
+	if s.groups["a"].group != groupA || s.groups["a"].group.Explorers[0] != explorerA {
+		t.Fatalf("expected unchanged group 'a' to be kept")
+	}
+
+	if s.groups["b"].group != groupB {
+		t.Fatalf("expected peer state of group 'b' to be kept")
+	}
+
+	if len(groupB.Handlers) != 1 {
+		t.Fatalf("expected group 'b' to have one handler, got %d", len(groupB.Handlers))
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), time.Second)
+	defer shutdownCancel()
+	cancel()
+	s.Shutdown(shutdownCtx)
+}
+
+func TestApplyRejectsReloadAtomically(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := New(ctx, nil)
+	if err := s.Apply(mustConfig(t, `
+groups:
+  a:
+    explorers:
+      - name: supervisortest:explorer
+`)); err != nil {
+		t.Fatalf("unexpected error applying configuration: %v", err)
+	}
+
+	groupA := s.groups["a"].group
+
+	err := s.Apply(mustConfig(t, `
+groups:
+  a:
+    handlers:
+      - name: supervisortest:handler
+  c:
+    explorers:
+      - name: supervisortest:explorer
+        configuration:
+          fail: true
+`))
+	if err == nil {
+		t.Fatalf("expected reload to be rejected")
+	}
+
+	if len(s.groups) != 1 || s.groups["a"].group != groupA {
+		t.Fatalf("expected running groups to be untouched after rejected reload")
+	}
+
+	if len(groupA.Explorers) != 1 || len(groupA.Handlers) != 0 {
+		t.Fatalf("expected group 'a' to keep its previous explorers and handlers")
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), time.Second)
+	defer shutdownCancel()
+	cancel()
+	s.Shutdown(shutdownCtx)
+}
+
+func TestApplyReleasesExplorersOfRejectedReload(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := New(ctx, nil)
+	err := s.Apply(mustConfig(t, `
+groups:
+  a:
+    explorers:
+      - name: supervisortest:closing
+      - name: supervisortest:explorer
+        configuration:
+          fail: true
+`))
+	if err == nil {
+		t.Fatalf("expected configuration to be rejected")
+	}
+
+	if n := closed.Load(); n != 1 {
+		t.Fatalf("expected explorer initialized for the rejected group to be closed, got %d close(s)", n)
+	}
+}
+
+func TestApplyLosesPeersOfRemovedStreamingExplorer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := New(ctx, nil)
+	if err := s.Apply(mustConfig(t, `
+groups:
+  a:
+    explorers:
+      - name: supervisortest:stream
+    handlers:
+      - name: supervisortest:notifying
+`)); err != nil {
+		t.Fatalf("unexpected error applying configuration: %v", err)
+	}
+
+	select {
+	case p := <-newPeers:
+		if p.ID != "streamed" {
+			t.Fatalf("unexpected new peer: %+v", p)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected streamed peer to be announced")
+	}
+
+	if err := s.Apply(mustConfig(t, `
+groups:
+  a:
+    handlers:
+      - name: supervisortest:notifying
+`)); err != nil {
+		t.Fatalf("unexpected error reloading configuration: %v", err)
+	}
+
+	select {
+	case p := <-lostPeers:
+		if p.ID != "streamed" {
+			t.Fatalf("unexpected lost peer: %+v", p)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected peer of removed streaming explorer to be lost")
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), time.Second)
+	defer shutdownCancel()
+	cancel()
+	s.Shutdown(shutdownCtx)
+}
+
+func TestApplyShutsDownRemovedHandlers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := New(ctx, nil)
+	if err := s.Apply(mustConfig(t, `
+groups:
+  a:
+    handlers:
+      - name: supervisortest:shutdown
+        configuration:
+          label: kept
+      - name: supervisortest:shutdown
+        configuration:
+          label: removed
+`)); err != nil {
+		t.Fatalf("unexpected error applying configuration: %v", err)
+	}
+
+	if err := s.Apply(mustConfig(t, `
+groups:
+  a:
+    handlers:
+      - name: supervisortest:shutdown
+        configuration:
+          label: kept
+`)); err != nil {
+		t.Fatalf("unexpected error reloading configuration: %v", err)
+	}
+
+	select {
+	case label := <-shutdowns:
+		if label != "removed" {
+			t.Fatalf("expected only the removed handler to be shut down, got '%s'", label)
+		}
+	default:
+		t.Fatal("expected removed handler to be shut down")
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), time.Second)
+	defer shutdownCancel()
+	cancel()
+	s.Shutdown(shutdownCtx)
+
+	if label := <-shutdowns; label != "kept" {
+		t.Fatalf("expected kept handler to be shut down with the supervisor, got '%s'", label)
+	}
+}
+
+func TestApplyNamesHandlersByID(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := New(ctx, nil)
+	if err := s.Apply(mustConfig(t, `
+groups:
+  a:
+    handlers:
+      - name: supervisortest:handler
+        id: first
+      - name: supervisortest:handler
+`)); err != nil {
+		t.Fatalf("unexpected error applying configuration: %v", err)
+	}
+
+	if names := s.groups["a"].group.HandlerNames; len(names) != 2 || names[0] != "first" || names[1] != "supervisortest:handler" {
+		t.Fatalf("unexpected handler names: %v", names)
+	}
+
+	if err := s.Apply(mustConfig(t, `
+groups:
+  a:
+    handlers:
+      - name: supervisortest:handler
+        id: renamed
+      - name: supervisortest:handler
+`)); err != nil {
+		t.Fatalf("unexpected error reloading configuration: %v", err)
+	}
+
+	if names := s.groups["a"].group.HandlerNames; len(names) != 2 || names[0] != "renamed" {
+		t.Fatalf("expected handler to be renamed with its ID, got %v", names)
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), time.Second)
+	defer shutdownCancel()
+	cancel()
+	s.Shutdown(shutdownCtx)
+}
+
+func TestValidateGroupLocatesProblems(t *testing.T) {
+	cfg := mustConfig(t, `
+groups:
+  a:
+    cadence:
+      interval: 1s
+    damping:
+      up_cycles: 1
+    handlers:
+      - name: supervisortest:handler
+      - name: supervisortest:handler
+        id: second
+        after: [missing]
+`)
+	cg := cfg.Groups["a"]
+
+	var settingsErr *SettingsError
+	if err := ValidateGroup(&cg); !errors.As(err, &settingsErr) {
+		t.Fatalf("expected settings error, got %v", err)
+	}
+
+	if line, column := settingsErr.Position(&cg); line != 10 || column != 9 {
+		t.Fatalf("expected problem to be located at the second handler, got %d:%d", line, column)
+	}
+
+	cg.Handlers[1].After = nil
+	cg.Damping.UpCycles = -1
+	if err := ValidateGroup(&cg); !errors.As(err, &settingsErr) {
+		t.Fatalf("expected settings error, got %v", err)
+	}
+
+	if line, column := settingsErr.Position(&cg); line != 7 || column != 7 {
+		t.Fatalf("expected problem to be located at the damping settings, got %d:%d", line, column)
+	}
+}
@@ -2,13 +2,16 @@ package explorer
 
 import (
 	"context"
+	"fmt"
 	"net"
 	"time"
 
+	"github.com/ravenix/peerd/internal/peer"
 	"gopkg.in/yaml.v3"
 )
 
 type Initializer func(*yaml.Node) (Explorer, error)
+type Validator func(*yaml.Node) error
 type Explorer interface {
 	Run(context.Context) error
 	Explore(context.Context, DiscoveryHandler) error
@@ -50,24 +53,74 @@ func normalizeCadence(c Cadence) Cadence {
 	return c
 }
 
-func ResolveCadence(explorers []Explorer) Cadence {
-	if len(explorers) == 0 {
-		return DefaultCadence()
+// Override returns the cadence with every value set in o replacing its own.
+func (c Cadence) Override(o Cadence) Cadence {
+	if o.ExploreInterval > 0 {
+		c.ExploreInterval = o.ExploreInterval
 	}
 
-	var cadence Cadence
-	for idx, e := range explorers {
-		provider, ok := e.(CadenceProvider)
-		current := DefaultCadence()
-		if ok {
-			current = provider.Cadence()
-		}
+	if o.ExploreTimeout > 0 {
+		c.ExploreTimeout = o.ExploreTimeout
+	}
+
+	if o.PeerTTL > 0 {
+		c.PeerTTL = o.PeerTTL
+	}
+
+	return c
+}
+
+// Validate checks a cadence given in configuration, where unset values are
+// left to the explorers.
+func (c Cadence) Validate() error {
+	if c.ExploreInterval < 0 || c.ExploreTimeout < 0 || c.PeerTTL < 0 {
+		return fmt.Errorf("interval, timeout and peer TTL must not be negative")
+	}
+
+	if c.ExploreInterval > 0 && c.ExploreTimeout > c.ExploreInterval {
+		return fmt.Errorf("timeout %s does not fit in interval %s", c.ExploreTimeout, c.ExploreInterval)
+	}
+
+	if c.ExploreInterval > 0 && c.PeerTTL > 0 && c.PeerTTL < c.ExploreInterval {
+		return fmt.Errorf("peer TTL %s is shorter than interval %s", c.PeerTTL, c.ExploreInterval)
+	}
+
+	return nil
+}
+
+// Problems describes why a resolved cadence does not work out.
+func (c Cadence) Problems() []string {
+	var problems []string
+	if c.ExploreTimeout > c.ExploreInterval {
+		problems = append(problems, fmt.Sprintf("timeout %s is longer than interval %s, cycles overlap", c.ExploreTimeout, c.ExploreInterval))
+	}
+
+	if c.PeerTTL < c.ExploreInterval {
+		problems = append(problems, fmt.Sprintf("peer TTL %s is shorter than interval %s, peers expire between cycles", c.PeerTTL, c.ExploreInterval))
+	}
+
+	return problems
+}
+
+// ExplorerCadence returns the cadence an explorer asks for.
+func ExplorerCadence(e Explorer) Cadence {
+	if provider, ok := e.(CadenceProvider); ok {
+		return normalizeCadence(provider.Cadence())
+	}
+
+	return DefaultCadence()
+}
+
+// CombineCadences finds a cadence suiting all explorers of a group: the
+// shortest interval, the longest timeout and the longest peer TTL.
+func CombineCadences(cadences []Cadence) Cadence {
+	if len(cadences) == 0 {
+		return DefaultCadence()
+	}
 
+	cadence := normalizeCadence(cadences[0])
+	for _, current := range cadences[1:] {
 		current = normalizeCadence(current)
-		if idx == 0 {
-			cadence = current
-			continue
-		}
 
 		if current.ExploreInterval < cadence.ExploreInterval {
 			cadence.ExploreInterval = current.ExploreInterval
@@ -85,12 +138,75 @@ func ResolveCadence(explorers []Explorer) Cadence {
 	return cadence
 }
 
+func ResolveCadence(explorers []Explorer) Cadence {
+	cadences := make([]Cadence, 0, len(explorers))
+	for _, e := range explorers {
+		cadences = append(cadences, ExplorerCadence(e))
+	}
+
+	return CombineCadences(cadences)
+}
+
 type Discovery struct {
-	IPv4Addr net.IP
-	IPv6Addr net.IP
-	Port     uint16
+	ID     string
+	Name   string
+	Labels map[string]string
+
+	IPv4Addr  net.IP
+	IPv6Addr  net.IP
+	Addresses []peer.Address
+	Port      uint16
+}
+
+func (d *Discovery) AllAddresses() []peer.Address {
+	if len(d.Addresses) > 0 {
+		return d.Addresses
+	}
+
+	var addresses []peer.Address
+	if d.IPv4Addr != nil {
+		addresses = append(addresses, peer.NewAddress(d.IPv4Addr))
+	}
+
+	if d.IPv6Addr != nil {
+		addresses = append(addresses, peer.NewAddress(d.IPv6Addr))
+	}
+
+	return addresses
+}
+
+func (d *Discovery) PrimaryAddresses() (net.IP, net.IP) {
+	ipv4Addr, ipv6Addr := d.IPv4Addr, d.IPv6Addr
+
+	for _, a := range d.Addresses {
+		if ipv4Addr == nil && a.Family == peer.FamilyIPv4 {
+			ipv4Addr = a.IP
+		}
+
+		if ipv6Addr == nil && a.Family == peer.FamilyIPv6 {
+			ipv6Addr = a.IP
+		}
+	}
+
+	return ipv4Addr, ipv6Addr
 }
 
 type DiscoveryHandler interface {
 	Discovered(*Discovery)
 }
+
+// EventHandler takes the changes reported by a Streamer. Discoveries should
+// carry an ID, an update or removal is matched to the earlier discovery by it.
+type EventHandler interface {
+	Added(*Discovery)
+	Updated(*Discovery)
+	Removed(*Discovery)
+}
+
+// Streamer is implemented by explorers which report peers as they come and go
+// instead of being asked for them every interval. Such an explorer is started
+// with Stream in place of Run and Explore is never called. Its peers do not
+// expire; they stay until they are removed or the explorer stops.
+type Streamer interface {
+	Stream(context.Context, EventHandler) error
+}
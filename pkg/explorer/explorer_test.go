@@ -83,3 +83,42 @@ func TestResolveCadenceSingleProviderUsesProviderValues(t *testing.T) {
 		t.Fatalf("expected peer ttl 300ms, got %s", cadence.PeerTTL)
 	}
 }
+
+func TestCadenceOverrideKeepsUnsetValues(t *testing.T) {
+	cadence := DefaultCadence().Override(Cadence{ExploreTimeout: 500 * time.Millisecond})
+
+	if cadence.ExploreInterval != DefaultCadence().ExploreInterval || cadence.ExploreTimeout != 500*time.Millisecond || cadence.PeerTTL != DefaultCadence().PeerTTL {
+		t.Fatalf("unexpected cadence: %v", cadence)
+	}
+}
+
+func TestCadenceValidate(t *testing.T) {
+	for _, c := range []Cadence{
+		{ExploreInterval: time.Second, ExploreTimeout: 2 * time.Second},
+		{ExploreInterval: time.Second, PeerTTL: 500 * time.Millisecond},
+		{ExploreTimeout: -time.Second},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Fatalf("expected error for %v", c)
+		}
+	}
+
+	if err := (Cadence{ExploreTimeout: 2 * time.Second}).Validate(); err != nil {
+		t.Fatalf("expected timeout without interval to be accepted: %v", err)
+	}
+}
+
+func TestCadenceProblems(t *testing.T) {
+	cadence := ResolveCadence([]Explorer{
+		testCadenceExplorer{c: Cadence{ExploreInterval: 100 * time.Millisecond, ExploreTimeout: 80 * time.Millisecond, PeerTTL: 300 * time.Millisecond}},
+		testCadenceExplorer{c: Cadence{ExploreInterval: 2 * time.Second, ExploreTimeout: 1500 * time.Millisecond, PeerTTL: 6 * time.Second}},
+	})
+
+	if problems := cadence.Problems(); len(problems) != 1 {
+		t.Fatalf("expected overlapping cycles to be reported, got %v", problems)
+	}
+
+	if problems := DefaultCadence().Problems(); len(problems) != 0 {
+		t.Fatalf("expected no problems with the default cadence, got %v", problems)
+	}
+}
@@ -8,9 +8,18 @@ import (
 )
 
 type Initializer func(*yaml.Node) (Handler, error)
+type Validator func(*yaml.Node) error
 type Handler interface {
 	PreExploration(context.Context, []*peer.Peer) error
 	NewPeer(context.Context, *peer.Peer) error
 	LostPeer(context.Context, *peer.Peer) error
 	PostExploration(context.Context, []*peer.Peer, []*peer.Peer, []*peer.Peer) error
 }
+
+type AddressChangeHandler interface {
+	PeerAddressChanged(context.Context, *peer.Peer, *peer.Peer) error
+}
+
+type Shutdowner interface {
+	Shutdown(context.Context, []*peer.Peer) error
+}
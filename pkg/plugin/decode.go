@@ -0,0 +1,155 @@
+package plugin
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type DecodeError struct {
+	Line    int
+	Column  int
+	Key     string
+	Message string
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Message)
+}
+
+var (
+	yamlNodeType        = reflect.TypeOf(yaml.Node{})
+	yamlUnmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+)
+
+func DecodeConfig(node *yaml.Node, out any) error {
+	if node == nil || node.Kind == 0 {
+		return nil
+	}
+
+	if err := checkKnownFields(node, reflect.TypeOf(out)); err != nil {
+		return err
+	}
+
+	return node.Decode(out)
+}
+
+func checkKnownFields(node *yaml.Node, t reflect.Type) error {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+
+	if node.Kind == yaml.DocumentNode {
+		if len(node.Content) == 0 {
+			return nil
+		}
+		return checkKnownFields(node.Content[0], t)
+	}
+
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t == yamlNodeType || reflect.PointerTo(t).Implements(yamlUnmarshalerType) {
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return nil
+		}
+
+		fields := make(map[string]reflect.Type)
+		collectFields(t, fields)
+
+		for idx := 0; idx+1 < len(node.Content); idx += 2 {
+			key, value := node.Content[idx], node.Content[idx+1]
+			if key.Value == "<<" {
+				continue
+			}
+
+			fieldType, ok := fields[key.Value]
+			if !ok {
+				fieldType, ok = fields[""]
+			}
+
+			if !ok {
+				return &DecodeError{
+					Line:    key.Line,
+					Column:  key.Column,
+					Key:     key.Value,
+					Message: fmt.Sprintf("unknown configuration key '%s'", key.Value),
+				}
+			}
+
+			if err := checkKnownFields(value, fieldType); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return nil
+		}
+
+		for idx := 1; idx < len(node.Content); idx += 2 {
+			if err := checkKnownFields(node.Content[idx], t.Elem()); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if node.Kind != yaml.SequenceNode {
+			return nil
+		}
+
+		for _, item := range node.Content {
+			if err := checkKnownFields(item, t.Elem()); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func collectFields(t reflect.Type, fields map[string]reflect.Type) {
+	for idx := 0; idx < t.NumField(); idx++ {
+		field := t.Field(idx)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		tag := field.Tag.Get("yaml")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+		if strings.Contains(","+opts+",", ",inline,") {
+			fieldType := field.Type
+			for fieldType.Kind() == reflect.Pointer {
+				fieldType = fieldType.Elem()
+			}
+
+			switch fieldType.Kind() {
+			case reflect.Struct:
+				collectFields(fieldType, fields)
+			case reflect.Map:
+				fields[""] = fieldType.Elem()
+			}
+			continue
+		}
+
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+
+		fields[name] = field.Type
+	}
+}
@@ -0,0 +1,78 @@
+package plugin
+
+import (
+	"errors"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+type testInlineConfig struct {
+	Server string `yaml:"server"`
+}
+
+type testDecodeConfig struct {
+	testInlineConfig `yaml:",inline"`
+	Port             uint16 `yaml:"port"`
+	Nested           struct {
+		Enabled bool `yaml:"enabled"`
+	} `yaml:"nested"`
+	Items []struct {
+		Name string `yaml:"name"`
+	} `yaml:"items"`
+}
+
+func mustNode(t *testing.T, contents string) *yaml.Node {
+	t.Helper()
+
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte(contents), &node); err != nil {
+		t.Fatalf("unexpected error parsing yaml: %v", err)
+	}
+
+	return &node
+}
+
+func TestDecodeConfigAcceptsKnownFields(t *testing.T) {
+	var config testDecodeConfig
+	err := DecodeConfig(mustNode(t, "server: a\nport: 179\nnested:\n  enabled: true\nitems:\n  - name: b\n"), &config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if config.Server != "a" || config.Port != 179 || !config.Nested.Enabled || len(config.Items) != 1 {
+		t.Fatalf("unexpected decoded configuration: %+v", config)
+	}
+}
+
+func TestDecodeConfigReportsUnknownFieldPosition(t *testing.T) {
+	for _, tc := range []struct {
+		contents string
+		key      string
+		line     int
+		column   int
+	}{
+		{"server: a\nport-number: 179\n", "port-number", 2, 1},
+		{"nested:\n  enable: true\n", "enable", 2, 3},
+		{"items:\n  - name: a\n  - nme: b\n", "nme", 3, 5},
+	} {
+		var config testDecodeConfig
+		err := DecodeConfig(mustNode(t, tc.contents), &config)
+
+		var decodeErr *DecodeError
+		if !errors.As(err, &decodeErr) {
+			t.Fatalf("expected decode error for %q, got %v", tc.key, err)
+		}
+
+		if decodeErr.Key != tc.key || decodeErr.Line != tc.line || decodeErr.Column != tc.column {
+			t.Fatalf("unexpected decode error for %q: %+v", tc.key, decodeErr)
+		}
+	}
+}
+
+func TestDecodeConfigAllowsEmptyConfiguration(t *testing.T) {
+	var config testDecodeConfig
+	if err := DecodeConfig(&yaml.Node{}, &config); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
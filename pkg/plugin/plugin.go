@@ -12,12 +12,16 @@ import (
 type PluginApi interface {
 	RegisterExplorer(name string, initializer explorer.Initializer)
 	RegisterHandler(name string, initializer handler.Initializer)
+	RegisterExplorerValidator(name string, validator explorer.Validator)
+	RegisterHandlerValidator(name string, validator handler.Validator)
 }
 
 type proxyPluginApi struct {
-	pluginName             string
-	registerExplorerMethod func(string, explorer.Initializer)
-	registerHandlerMethod  func(string, handler.Initializer)
+	pluginName                      string
+	registerExplorerMethod          func(string, explorer.Initializer)
+	registerHandlerMethod           func(string, handler.Initializer)
+	registerExplorerValidatorMethod func(string, explorer.Validator)
+	registerHandlerValidatorMethod  func(string, handler.Validator)
 }
 
 type SetupFunc func(PluginApi)
@@ -35,6 +39,9 @@ func Register(name string, setupFunc SetupFunc) {
 		pluginName:             name,
 		registerExplorerMethod: r.RegisterExplorer,
 		registerHandlerMethod:  r.RegisterHandler,
+
+		registerExplorerValidatorMethod: r.RegisterExplorerValidator,
+		registerHandlerValidatorMethod:  r.RegisterHandlerValidator,
 	})
 }
 
@@ -54,6 +61,30 @@ func InitializeHandler(name string, config *yaml.Node) (handler.Handler, error)
 	return r.handlers[name](config)
 }
 
+func ValidateExplorer(name string, config *yaml.Node) error {
+	if r.explorers[name] == nil {
+		return fmt.Errorf("explorer with name '%s' does not exist", name)
+	}
+
+	if r.explorerValidators[name] == nil {
+		return nil
+	}
+
+	return r.explorerValidators[name](config)
+}
+
+func ValidateHandler(name string, config *yaml.Node) error {
+	if r.handlers[name] == nil {
+		return fmt.Errorf("handler with name '%s' does not exist", name)
+	}
+
+	if r.handlerValidators[name] == nil {
+		return nil
+	}
+
+	return r.handlerValidators[name](config)
+}
+
 func (p *proxyPluginApi) RegisterExplorer(name string, initializer explorer.Initializer) {
 	p.registerExplorerMethod(p.pluginName+":"+name, initializer)
 }
@@ -61,3 +92,11 @@ func (p *proxyPluginApi) RegisterExplorer(name string, initializer explorer.Init
 func (p *proxyPluginApi) RegisterHandler(name string, initializer handler.Initializer) {
 	p.registerHandlerMethod(p.pluginName+":"+name, initializer)
 }
+
+func (p *proxyPluginApi) RegisterExplorerValidator(name string, validator explorer.Validator) {
+	p.registerExplorerValidatorMethod(p.pluginName+":"+name, validator)
+}
+
+func (p *proxyPluginApi) RegisterHandlerValidator(name string, validator handler.Validator) {
+	p.registerHandlerValidatorMethod(p.pluginName+":"+name, validator)
+}
@@ -0,0 +1,38 @@
+package plugin
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ravenix/peerd/pkg/explorer"
+	"gopkg.in/yaml.v3"
+)
+
+func TestValidateExplorerRejectsUnknownName(t *testing.T) {
+	if err := ValidateExplorer("unknown:explorer", &yaml.Node{}); err == nil {
+		t.Fatalf("expected error for unknown explorer")
+	}
+}
+
+func TestValidateExplorerRunsValidatorWithoutInitializing(t *testing.T) {
+	expectedErr := errors.New("invalid configuration")
+	initialized := false
+
+	Register("validatetest", func(api PluginApi) {
+		api.RegisterExplorer("explorer", func(*yaml.Node) (explorer.Explorer, error) {
+			initialized = true
+			return nil, nil
+		})
+		api.RegisterExplorerValidator("explorer", func(*yaml.Node) error {
+			return expectedErr
+		})
+	})
+
+	if err := ValidateExplorer("validatetest:explorer", &yaml.Node{}); !errors.Is(err, expectedErr) {
+		t.Fatalf("expected error %v, got %v", expectedErr, err)
+	}
+
+	if initialized {
+		t.Fatalf("expected explorer not to be initialized during validation")
+	}
+}
@@ -7,14 +7,18 @@ import (
 )
 
 type registry struct {
-	explorers map[string]explorer.Initializer
-	handlers  map[string]handler.Initializer
+	explorers          map[string]explorer.Initializer
+	handlers           map[string]handler.Initializer
+	explorerValidators map[string]explorer.Validator
+	handlerValidators  map[string]handler.Validator
 }
 
 func NewRegistry() *registry {
 	r = new(registry)
 	r.explorers = make(map[string]explorer.Initializer)
 	r.handlers = make(map[string]handler.Initializer)
+	r.explorerValidators = make(map[string]explorer.Validator)
+	r.handlerValidators = make(map[string]handler.Validator)
 	return r
 }
 
@@ -27,3 +31,11 @@ func (r *registry) RegisterHandler(name string, handler handler.Initializer) {
 	r.handlers[name] = handler
 	log.Infof("Registering handler '%s'", name)
 }
+
+func (r *registry) RegisterExplorerValidator(name string, validator explorer.Validator) {
+	r.explorerValidators[name] = validator
+}
+
+func (r *registry) RegisterHandlerValidator(name string, validator handler.Validator) {
+	r.handlerValidators[name] = validator
+}
@@ -4,10 +4,14 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"os"
 	osexec "os/exec"
+	"strconv"
+	"strings"
 
 	"github.com/ravenix/peerd/internal/peer"
 	"github.com/ravenix/peerd/pkg/handler"
+	"github.com/ravenix/peerd/pkg/plugin"
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v3"
 )
@@ -22,6 +26,8 @@ type commandHandlerConfig struct {
 	OnPreExploration  bool     `yaml:"on_pre_exploration"`
 	OnNewPeer         bool     `yaml:"on_new_peer"`
 	OnLostPeer        bool     `yaml:"on_lost_peer"`
+	OnAddressChange   bool     `yaml:"on_address_change"`
+	OnShutdown        bool     `yaml:"on_shutdown"`
 	OnPostExploration struct {
 		Always    bool `yaml:"always"`
 		NewPeers  bool `yaml:"new_peers"`
@@ -31,16 +37,33 @@ type commandHandlerConfig struct {
 
 func commandHandlerInitializer(yamlConfig *yaml.Node) (handler.Handler, error) {
 	var config commandHandlerConfig
-	if err := yamlConfig.Decode(&config); err != nil {
+	if err := plugin.DecodeConfig(yamlConfig, &config); err != nil {
 		return nil, err
 	}
 
 	return newcommandHandler(&config)
 }
 
+func commandHandlerValidator(yamlConfig *yaml.Node) error {
+	var config commandHandlerConfig
+	if err := plugin.DecodeConfig(yamlConfig, &config); err != nil {
+		return err
+	}
+
+	return config.validate()
+}
+
+func (c *commandHandlerConfig) validate() error {
+	if c.Command == "" {
+		return fmt.Errorf("command must not be empty")
+	}
+
+	return nil
+}
+
 func newcommandHandler(config *commandHandlerConfig) (*commandHandler, error) {
-	if config.Command == "" {
-		return nil, fmt.Errorf("command must not be empty")
+	if err := config.validate(); err != nil {
+		return nil, err
 	}
 
 	r := &commandHandler{
@@ -50,25 +73,33 @@ func newcommandHandler(config *commandHandlerConfig) (*commandHandler, error) {
 	return r, nil
 }
 
-func (r *commandHandler) PreExploration(context.Context, []*peer.Peer) error {
+func (r *commandHandler) PreExploration(ctx context.Context, peers []*peer.Peer) error {
 	if r.c.OnPreExploration {
-		return r.run()
+		return r.run(ctx, nil)
 	}
 
 	return nil
 }
 
-func (r *commandHandler) NewPeer(context.Context, *peer.Peer) error {
+func (r *commandHandler) NewPeer(ctx context.Context, p *peer.Peer) error {
 	if r.c.OnNewPeer {
-		return r.run()
+		return r.run(ctx, peerEnv("PEERD_PEER", p))
 	}
 
 	return nil
 }
 
-func (r *commandHandler) LostPeer(context.Context, *peer.Peer) error {
+func (r *commandHandler) LostPeer(ctx context.Context, p *peer.Peer) error {
 	if r.c.OnLostPeer {
-		return r.run()
+		return r.run(ctx, peerEnv("PEERD_PEER", p))
+	}
+
+	return nil
+}
+
+func (r *commandHandler) PeerAddressChanged(ctx context.Context, previous *peer.Peer, current *peer.Peer) error {
+	if r.c.OnAddressChange {
+		return r.run(ctx, append(peerEnv("PEERD_PEER", current), peerEnv("PEERD_PREVIOUS_PEER", previous)...))
 	}
 
 	return nil
@@ -76,19 +107,30 @@ func (r *commandHandler) LostPeer(context.Context, *peer.Peer) error {
 
 func (r *commandHandler) PostExploration(ctx context.Context, peers []*peer.Peer, newPeers []*peer.Peer, lostPeers []*peer.Peer) error {
 	if r.c.OnPostExploration.Always || (r.c.OnPostExploration.NewPeers && len(newPeers) > 0) || (r.c.OnPostExploration.LostPeers && len(lostPeers) > 0) {
-		return r.run()
+		return r.run(ctx, nil)
+	}
+
+	return nil
+}
+
+func (r *commandHandler) Shutdown(ctx context.Context, peers []*peer.Peer) error {
+	if r.c.OnShutdown {
+		return r.run(ctx, nil)
 	}
 
 	return nil
 }
 
-func (r *commandHandler) run() error {
+func (r *commandHandler) run(ctx context.Context, env []string) error {
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
 
-	cmd := osexec.Command(r.c.Command, r.c.Args...)
+	cmd := osexec.CommandContext(ctx, r.c.Command, r.c.Args...)
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
 
 	err := cmd.Run()
 
@@ -100,3 +142,22 @@ func (r *commandHandler) run() error {
 
 	return err
 }
+
+func peerEnv(prefix string, p *peer.Peer) []string {
+	return []string{
+		prefix + "_ID=" + p.ID,
+		prefix + "_NAME=" + p.Name,
+		prefix + "_PORT=" + strconv.Itoa(int(p.Port)),
+		prefix + "_ADDRESSES=" + joinAddresses(p.Addresses),
+		prefix + "_IPV4_ADDRESSES=" + joinAddresses(peer.FilterAddresses(p.Addresses, peer.FamilyIPv4)),
+		prefix + "_IPV6_ADDRESSES=" + joinAddresses(peer.FilterAddresses(p.Addresses, peer.FamilyIPv6)),
+	}
+}
+
+func joinAddresses(addresses []peer.Address) string {
+	tmp := make([]string, 0, len(addresses))
+	for _, a := range addresses {
+		tmp = append(tmp, a.String())
+	}
+	return strings.Join(tmp, " ")
+}
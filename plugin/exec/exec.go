@@ -10,4 +10,5 @@ func init() {
 
 func setup(api plugin.PluginApi) {
 	api.RegisterHandler("command", commandHandlerInitializer)
+	api.RegisterHandlerValidator("command", commandHandlerValidator)
 }
@@ -11,6 +11,7 @@ import (
 
 	"github.com/godbus/dbus/v5"
 	"github.com/ravenix/peerd/pkg/explorer"
+	"github.com/ravenix/peerd/pkg/plugin"
 	"gopkg.in/yaml.v3"
 )
 
@@ -19,9 +20,12 @@ const (
 	keepalivedInstanceIfcName  = "org.keepalived.Vrrp1.Instance"
 	keepalivedInstanceProperty = "State"
 	keepalivedMasterState      = 2
+
+	labelInstancePath = "keepalived.instance_path"
 )
 
 type instanceExplorer struct {
+	instanceName       string
 	instanceObjectPath string
 	peerIPv4           net.IP
 	peerIPv6           net.IP
@@ -42,33 +46,52 @@ type instanceExplorerConfig struct {
 
 func instanceExplorerInitializer(yamlConfig *yaml.Node) (explorer.Explorer, error) {
 	var config instanceExplorerConfig
-	if err := yamlConfig.Decode(&config); err != nil {
+	if err := plugin.DecodeConfig(yamlConfig, &config); err != nil {
 		return nil, err
 	}
 
 	return newInstanceExplorer(&config)
 }
 
-func newInstanceExplorer(config *instanceExplorerConfig) (*instanceExplorer, error) {
-	if config.Interface == "" {
-		return nil, fmt.Errorf("interface must be set")
+func instanceExplorerValidator(yamlConfig *yaml.Node) error {
+	var config instanceExplorerConfig
+	if err := plugin.DecodeConfig(yamlConfig, &config); err != nil {
+		return err
 	}
 
-	if config.VirtualRouterID == 0 {
-		return nil, fmt.Errorf("virtual_router_id must be set")
+	return config.validate()
+}
+
+func (c *instanceExplorerConfig) validate() error {
+	if c.Interface == "" {
+		return fmt.Errorf("interface must be set")
 	}
 
-	peerIPv4, err := parseIPv4(config.PeerIPv4)
-	if err != nil {
-		return nil, fmt.Errorf("invalid peer_ipv4: %w", err)
+	if c.VirtualRouterID == 0 {
+		return fmt.Errorf("virtual_router_id must be set")
 	}
 
-	peerIPv6, err := parseIPv6(config.PeerIPv6)
-	if err != nil {
-		return nil, fmt.Errorf("invalid peer_ipv6: %w", err)
+	if _, err := parseIPv4(c.PeerIPv4); err != nil {
+		return fmt.Errorf("invalid peer_ipv4: %w", err)
+	}
+
+	if _, err := parseIPv6(c.PeerIPv6); err != nil {
+		return fmt.Errorf("invalid peer_ipv6: %w", err)
 	}
 
+	return nil
+}
+
+func newInstanceExplorer(config *instanceExplorerConfig) (*instanceExplorer, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	peerIPv4, _ := parseIPv4(config.PeerIPv4)
+	peerIPv6, _ := parseIPv6(config.PeerIPv6)
+
 	e := &instanceExplorer{
+		instanceName:       fmt.Sprintf("%s/%d", config.Interface, config.VirtualRouterID),
 		instanceObjectPath: instanceObjectPath(config.Interface, config.VirtualRouterID),
 		peerIPv4:           peerIPv4,
 		peerIPv6:           peerIPv6,
@@ -104,6 +127,11 @@ func (e *instanceExplorer) Explore(ctx context.Context, dh explorer.DiscoveryHan
 	}
 
 	dh.Discovered(&explorer.Discovery{
+		ID:   e.instanceObjectPath,
+		Name: e.instanceName,
+		Labels: map[string]string{
+			labelInstancePath: e.instanceObjectPath,
+		},
 		IPv4Addr: copyIP(e.peerIPv4),
 		IPv6Addr: copyIP(e.peerIPv6),
 		Port:     e.port,
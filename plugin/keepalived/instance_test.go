@@ -45,6 +45,14 @@ func TestExploreDiscoveredWhenStateIsMaster(t *testing.T) {
 	}
 
 	discovery := h.discoveries[0]
+	if discovery.ID != "/org/keepalived/Vrrp1/Instance/eth0/42/IPv6" || discovery.Name != "eth0/42" {
+		t.Fatalf("unexpected identity: id=%q name=%q", discovery.ID, discovery.Name)
+	}
+
+	if discovery.Labels[labelInstancePath] != discovery.ID {
+		t.Fatalf("unexpected labels: %v", discovery.Labels)
+	}
+
 	if !discovery.IPv4Addr.Equal(net.ParseIP("10.0.0.2").To4()) {
 		t.Fatalf("unexpected ipv4 address: %v", discovery.IPv4Addr)
 	}
@@ -8,4 +8,5 @@ func init() {
 
 func setup(api plugin.PluginApi) {
 	api.RegisterExplorer("instance", instanceExplorerInitializer)
+	api.RegisterExplorerValidator("instance", instanceExplorerValidator)
 }
@@ -0,0 +1,229 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/ravenix/peerd/internal/peer"
+	"github.com/ravenix/peerd/pkg/explorer"
+	"github.com/ravenix/peerd/pkg/plugin"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	labelService  = "kubernetes.service"
+	labelHostname = "kubernetes.hostname"
+	labelZone     = "kubernetes.zone"
+)
+
+// endpointSliceExplorer reports the endpoints of a service. The endpoints of
+// all slices of the service are combined, so a dual-stack endpoint is one peer
+// with the addresses of both families.
+type endpointSliceExplorer struct {
+	*resourceExplorer
+	service            string
+	portName           string
+	serving            bool
+	excludeTerminating bool
+}
+
+var endpointSliceResource = resourceType{
+	name:   "endpointslices",
+	object: &discoveryv1.EndpointSlice{},
+	list: func(ctx context.Context, client kubernetes.Interface, namespace string, options metav1.ListOptions) (runtime.Object, error) {
+		return client.DiscoveryV1().EndpointSlices(namespace).List(ctx, options)
+	},
+	watch: func(ctx context.Context, client kubernetes.Interface, namespace string, options metav1.ListOptions) (watch.Interface, error) {
+		return client.DiscoveryV1().EndpointSlices(namespace).Watch(ctx, options)
+	},
+}
+
+type endpointSliceExplorerConfig struct {
+	resourceExplorerConfig `yaml:",inline"`
+	Service                string `yaml:"service"`
+	Namespace              string `yaml:"namespace"`
+	PortName               string `yaml:"port_name"`
+	Serving                bool   `yaml:"serving"`
+	ExcludeTerminating     bool   `yaml:"exclude_terminating"`
+}
+
+func endpointSliceExplorerInitializer(yamlConfig *yaml.Node) (explorer.Explorer, error) {
+	var config endpointSliceExplorerConfig
+	if err := plugin.DecodeConfig(yamlConfig, &config); err != nil {
+		return nil, err
+	}
+
+	return newEndpointSliceExplorer(&config)
+}
+
+func endpointSliceExplorerValidator(yamlConfig *yaml.Node) error {
+	var config endpointSliceExplorerConfig
+	if err := plugin.DecodeConfig(yamlConfig, &config); err != nil {
+		return err
+	}
+
+	return config.validate()
+}
+
+func (c *endpointSliceExplorerConfig) validate() error {
+	if err := c.resourceExplorerConfig.validate(); err != nil {
+		return err
+	}
+
+	if c.Service == "" || c.Namespace == "" {
+		return fmt.Errorf("service and namespace must be set")
+	}
+
+	return nil
+}
+
+func newEndpointSliceExplorer(config *endpointSliceExplorerConfig) (*endpointSliceExplorer, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	e := &endpointSliceExplorer{}
+	arc, err := newResourceExplorer(&config.resourceExplorerConfig, endpointSliceResource, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	e.resourceExplorer = arc
+	e.exploreAll = e.exploreEndpointSlices
+	e.namespaces = []string{config.Namespace}
+	e.labelSelector = discoveryv1.LabelServiceName + "=" + config.Service
+	if config.LabelSelector != "" {
+		e.labelSelector += "," + config.LabelSelector
+	}
+
+	e.service = config.Service
+	e.portName = config.PortName
+	e.serving = config.Serving
+	e.excludeTerminating = config.ExcludeTerminating
+	return e, nil
+}
+
+func (e *endpointSliceExplorer) exploreEndpointSlices(ctx context.Context, resources []any) []*explorer.Discovery {
+	var slices []*discoveryv1.EndpointSlice
+	for _, resource := range resources {
+		if slice, ok := resource.(*discoveryv1.EndpointSlice); ok {
+			slices = append(slices, slice)
+		}
+	}
+
+	sort.Slice(slices, func(i, j int) bool {
+		return slices[i].Name < slices[j].Name
+	})
+
+	var discoveries []*explorer.Discovery
+	byID := make(map[string]*explorer.Discovery)
+	for _, slice := range slices {
+		port, ok := e.slicePort(slice)
+		if !ok {
+			log.Debugf("skipping endpoint slice %s/%s without port '%s'", slice.Namespace, slice.Name, e.portName)
+			continue
+		}
+
+		for idx := range slice.Endpoints {
+			endpoint := &slice.Endpoints[idx]
+			if !e.includeEndpoint(endpoint) {
+				continue
+			}
+
+			var addresses []peer.Address
+			for _, address := range endpoint.Addresses {
+				if ipAddr := net.ParseIP(address); ipAddr != nil {
+					addresses = append(addresses, peer.NewAddress(ipAddr))
+				}
+			}
+
+			if len(addresses) == 0 {
+				continue
+			}
+
+			name := endpointName(endpoint)
+			id := "endpoint/" + slice.Namespace + "/" + e.service + "/" + name
+			dis, ok := byID[id]
+			if !ok {
+				dis = &explorer.Discovery{
+					ID:   id,
+					Name: name,
+					Labels: map[string]string{
+						labelNamespace: slice.Namespace,
+						labelService:   e.service,
+					},
+					Port: port,
+				}
+				byID[id] = dis
+				discoveries = append(discoveries, dis)
+			}
+
+			dis.Addresses = append(dis.Addresses, addresses...)
+			if endpoint.Hostname != nil {
+				dis.Labels[labelHostname] = *endpoint.Hostname
+			}
+
+			if endpoint.NodeName != nil {
+				dis.Labels[labelNodeName] = *endpoint.NodeName
+			}
+
+			if endpoint.Zone != nil {
+				dis.Labels[labelZone] = *endpoint.Zone
+			}
+		}
+	}
+
+	return discoveries
+}
+
+// includeEndpoint applies the conditions of the endpoint. Without a serving
+// condition, as reported by older clusters, an endpoint serves when it is ready.
+// An unknown ready condition counts as ready.
+func (e *endpointSliceExplorer) includeEndpoint(endpoint *discoveryv1.Endpoint) bool {
+	conditions := endpoint.Conditions
+	if e.excludeTerminating && conditions.Terminating != nil && *conditions.Terminating {
+		return false
+	}
+
+	if e.serving && conditions.Serving != nil {
+		return *conditions.Serving
+	}
+
+	return conditions.Ready == nil || *conditions.Ready
+}
+
+func (e *endpointSliceExplorer) slicePort(slice *discoveryv1.EndpointSlice) (uint16, bool) {
+	for _, port := range slice.Ports {
+		if port.Port == nil {
+			continue
+		}
+
+		if e.portName == "" || (port.Name != nil && *port.Name == e.portName) {
+			return uint16(*port.Port), true
+		}
+	}
+
+	return 0, e.portName == ""
+}
+
+// endpointName identifies the endpoint across slices: by the object it targets,
+// its hostname or, lacking both, its first address.
+func endpointName(endpoint *discoveryv1.Endpoint) string {
+	switch {
+	case endpoint.TargetRef != nil && endpoint.TargetRef.Name != "":
+		return endpoint.TargetRef.Name
+	case endpoint.Hostname != nil && *endpoint.Hostname != "":
+		return *endpoint.Hostname
+	default:
+		return endpoint.Addresses[0]
+	}
+}
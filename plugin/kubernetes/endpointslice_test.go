@@ -0,0 +1,163 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func newTestEndpointSlice(name string, addressType discoveryv1.AddressType, endpoints ...discoveryv1.Endpoint) *discoveryv1.EndpointSlice {
+	return &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "router-system",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: "router"},
+		},
+		AddressType: addressType,
+		Endpoints:   endpoints,
+		Ports: []discoveryv1.EndpointPort{
+			{Name: ptr.To("metrics"), Port: ptr.To[int32](9090)},
+			{Name: ptr.To("bgp"), Port: ptr.To[int32](179)},
+		},
+	}
+}
+
+func newTestEndpoint(pod string, address string, ready bool, serving bool, terminating bool) discoveryv1.Endpoint {
+	return discoveryv1.Endpoint{
+		Addresses: []string{address},
+		Conditions: discoveryv1.EndpointConditions{
+			Ready:       ptr.To(ready),
+			Serving:     ptr.To(serving),
+			Terminating: ptr.To(terminating),
+		},
+		NodeName:  ptr.To("node-a"),
+		Zone:      ptr.To("zone-1"),
+		TargetRef: &corev1.ObjectReference{Kind: "Pod", Name: pod},
+	}
+}
+
+func newTestEndpointSliceExplorer(t *testing.T, config endpointSliceExplorerConfig) *endpointSliceExplorer {
+	config.ApiServer = "https://" + t.Name()
+	config.Service, config.Namespace = "router", "router-system"
+
+	e, err := newEndpointSliceExplorer(&config)
+	if err != nil {
+		t.Fatalf("unexpected error creating endpoint slice explorer: %v", err)
+	}
+
+	return e
+}
+
+func TestExploreEndpointSlicesCombinesAddressFamilies(t *testing.T) {
+	e := newTestEndpointSliceExplorer(t, endpointSliceExplorerConfig{PortName: "bgp"})
+
+	discoveries := e.exploreEndpointSlices(context.Background(), []any{
+		newTestEndpointSlice("router-ipv6", discoveryv1.AddressTypeIPv6,
+			newTestEndpoint("router-0", "fd00::1", true, true, false),
+		),
+		newTestEndpointSlice("router-ipv4", discoveryv1.AddressTypeIPv4,
+			newTestEndpoint("router-0", "10.0.0.1", true, true, false),
+			newTestEndpoint("router-1", "10.0.0.2", false, false, false),
+		),
+	})
+
+	if len(discoveries) != 1 {
+		t.Fatalf("expected one ready endpoint, got %d", len(discoveries))
+	}
+
+	dis := discoveries[0]
+	if dis.ID != "endpoint/router-system/router/router-0" || dis.Port != 179 || len(dis.Addresses) != 2 {
+		t.Fatalf("unexpected discovery: %+v", dis)
+	}
+
+	if dis.Labels[labelNodeName] != "node-a" || dis.Labels[labelZone] != "zone-1" || dis.Labels[labelService] != "router" {
+		t.Fatalf("unexpected labels: %v", dis.Labels)
+	}
+}
+
+func TestExploreEndpointSlicesHonoursConditions(t *testing.T) {
+	slice := newTestEndpointSlice("router-ipv4", discoveryv1.AddressTypeIPv4,
+		newTestEndpoint("router-0", "10.0.0.1", true, true, false),
+		newTestEndpoint("router-1", "10.0.0.2", false, true, true),
+		newTestEndpoint("router-2", "10.0.0.3", false, false, true),
+	)
+
+	for name, tc := range map[string]struct {
+		config   endpointSliceExplorerConfig
+		expected int
+	}{
+		"ready":                   {expected: 1},
+		"serving":                 {config: endpointSliceExplorerConfig{Serving: true}, expected: 2},
+		"serving not terminating": {config: endpointSliceExplorerConfig{Serving: true, ExcludeTerminating: true}, expected: 1},
+		"missing port":            {config: endpointSliceExplorerConfig{PortName: "http"}},
+	} {
+		e := newTestEndpointSliceExplorer(t, tc.config)
+		if discoveries := e.exploreEndpointSlices(context.Background(), []any{slice}); len(discoveries) != tc.expected {
+			t.Errorf("%s: expected %d endpoint(s), got %d", name, tc.expected, len(discoveries))
+		}
+	}
+}
+
+func TestExploreEndpointSlicesFallsBackToReadyWithoutServing(t *testing.T) {
+	ready := newTestEndpoint("router-0", "10.0.0.1", true, false, false)
+	notReady := newTestEndpoint("router-1", "10.0.0.2", false, false, false)
+	ready.Conditions.Serving, notReady.Conditions.Serving = nil, nil
+
+	e := newTestEndpointSliceExplorer(t, endpointSliceExplorerConfig{Serving: true})
+	discoveries := e.exploreEndpointSlices(context.Background(), []any{
+		newTestEndpointSlice("router-ipv4", discoveryv1.AddressTypeIPv4, ready, notReady),
+	})
+
+	if len(discoveries) != 1 || discoveries[0].ID != "endpoint/router-system/router/router-0" {
+		t.Fatalf("expected only the ready endpoint, got %+v", discoveries)
+	}
+}
+
+func TestStreamEndpointSlicesReportsChanges(t *testing.T) {
+	e := newTestEndpointSliceExplorer(t, endpointSliceExplorerConfig{})
+	client, watching := newFakeClientset("endpointslices",
+		newTestEndpointSlice("router-ipv4", discoveryv1.AddressTypeIPv4, newTestEndpoint("router-0", "10.0.0.1", true, true, false)),
+	)
+	e.k8sClient = client
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := make(testEventHandler, 10)
+	go func() { _ = e.Stream(ctx, events) }()
+
+	if ev := events.next(t); ev.kind != "added" || ev.discovery.ID != "endpoint/router-system/router/router-0" {
+		t.Fatalf("unexpected event: %+v", ev)
+	}
+	<-watching
+
+	slices := client.DiscoveryV1().EndpointSlices("router-system")
+	if _, err := slices.Create(ctx, newTestEndpointSlice("router-ipv6", discoveryv1.AddressTypeIPv6, newTestEndpoint("router-0", "fd00::1", true, true, false)), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if ev := events.next(t); ev.kind != "updated" || len(ev.discovery.Addresses) != 2 {
+		t.Fatalf("unexpected event: %+v", ev)
+	}
+
+	terminating := newTestEndpointSlice("router-ipv4", discoveryv1.AddressTypeIPv4, newTestEndpoint("router-0", "10.0.0.1", false, true, true))
+	if _, err := slices.Update(ctx, terminating, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if ev := events.next(t); ev.kind != "updated" || len(ev.discovery.Addresses) != 1 || ev.discovery.Addresses[0].IP.String() != "fd00::1" {
+		t.Fatalf("unexpected event: %+v", ev)
+	}
+
+	if err := slices.Delete(ctx, "router-ipv6", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if ev := events.next(t); ev.kind != "removed" || ev.discovery.ID != "endpoint/router-system/router/router-0" {
+		t.Fatalf("unexpected event: %+v", ev)
+	}
+}
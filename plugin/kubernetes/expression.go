@@ -0,0 +1,149 @@
+package kubernetes
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/ravenix/peerd/pkg/explorer"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// expressionConfig takes the port, name and labels of peers from the objects
+// they are discovered from. Expressions are JSONPath templates as accepted by
+// kubectl -o jsonpath, e.g. {.metadata.annotations.peerd\.io/port}. An object
+// any expression yields no value for is skipped.
+type expressionConfig struct {
+	PortExpression   string            `yaml:"port_expression"`
+	NameExpression   string            `yaml:"name_expression"`
+	LabelExpressions map[string]string `yaml:"label_expressions"`
+}
+
+// expressions are parsed once per explorer. A parsed template keeps state
+// while it runs, so the explorer applies them to one object at a time.
+type expressions struct {
+	mu     sync.Mutex
+	port   *jsonpath.JSONPath
+	name   *jsonpath.JSONPath
+	labels map[string]*jsonpath.JSONPath
+}
+
+func (c *expressionConfig) validate() error {
+	for name, expression := range c.all() {
+		if _, err := parseExpression(name, expression); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *expressionConfig) all() map[string]string {
+	all := make(map[string]string, len(c.LabelExpressions)+2)
+	for key, expression := range c.LabelExpressions {
+		all["label '"+key+"'"] = expression
+	}
+
+	if c.PortExpression != "" {
+		all["port"] = c.PortExpression
+	}
+
+	if c.NameExpression != "" {
+		all["name"] = c.NameExpression
+	}
+
+	return all
+}
+
+func (c *expressionConfig) expressions() (*expressions, error) {
+	if c.PortExpression == "" && c.NameExpression == "" && len(c.LabelExpressions) == 0 {
+		return nil, nil
+	}
+
+	x := &expressions{labels: make(map[string]*jsonpath.JSONPath, len(c.LabelExpressions))}
+	for key, expression := range c.LabelExpressions {
+		path, err := parseExpression("label '"+key+"'", expression)
+		if err != nil {
+			return nil, err
+		}
+		x.labels[key] = path
+	}
+
+	var err error
+	if c.PortExpression != "" {
+		if x.port, err = parseExpression("port", c.PortExpression); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.NameExpression != "" {
+		if x.name, err = parseExpression("name", c.NameExpression); err != nil {
+			return nil, err
+		}
+	}
+
+	return x, nil
+}
+
+func parseExpression(name string, expression string) (*jsonpath.JSONPath, error) {
+	path := jsonpath.New(name)
+	if err := path.Parse(expression); err != nil {
+		return nil, fmt.Errorf("invalid %s expression '%s': %w", name, expression, err)
+	}
+
+	return path, nil
+}
+
+// apply sets what the expressions yield for the object on the discovery.
+func (x *expressions) apply(obj any, dis *explorer.Discovery) error {
+	object, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return err
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if x.port != nil {
+		value, err := evaluate("port", x.port, object)
+		if err != nil {
+			return err
+		}
+
+		port, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid port '%s'", value)
+		}
+		dis.Port = uint16(port)
+	}
+
+	if x.name != nil {
+		if dis.Name, err = evaluate("name", x.name, object); err != nil {
+			return err
+		}
+	}
+
+	for key, path := range x.labels {
+		if dis.Labels[key], err = evaluate("label '"+key+"'", path, object); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// evaluate runs a parsed expression against an object.
+func evaluate(name string, path *jsonpath.JSONPath, object map[string]any) (string, error) {
+	var buf bytes.Buffer
+	if err := path.Execute(&buf, object); err != nil {
+		return "", fmt.Errorf("%s expression: %w", name, err)
+	}
+
+	if buf.Len() == 0 {
+		return "", fmt.Errorf("%s expression yields no value", name)
+	}
+
+	return buf.String(), nil
+}
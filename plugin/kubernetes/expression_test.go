@@ -0,0 +1,121 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestExplorePodAppliesExpressions(t *testing.T) {
+	e, err := newpodExplorer(&podExplorerConfig{
+		resourceExplorerConfig: resourceExplorerConfig{
+			ApiServer: "https://127.0.0.1",
+		},
+		expressionConfig: expressionConfig{
+			PortExpression: `{.metadata.annotations.peerd\.io/port}`,
+			NameExpression: `{.metadata.labels.app}-{.metadata.name}`,
+			LabelExpressions: map[string]string{
+				"role": `{.metadata.annotations.peerd\.io/role}`,
+				"node": "{.spec.nodeName}",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating pod explorer: %v", err)
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "router-0",
+			Namespace:   "router-system",
+			Labels:      map[string]string{"app": "router"},
+			Annotations: map[string]string{"peerd.io/port": "1179", "peerd.io/role": "reflector"},
+		},
+		Spec:   corev1.PodSpec{NodeName: "node-a"},
+		Status: corev1.PodStatus{PodIP: "10.0.0.1"},
+	}
+
+	dis := e.explore(context.Background(), pod)
+	if dis == nil {
+		t.Fatalf("expected discovery")
+	}
+
+	if dis.ID != "pod/router-system/router-0" || dis.Name != "router-router-0" || dis.Port != 1179 {
+		t.Fatalf("unexpected discovery: %+v", dis)
+	}
+
+	if dis.Labels["role"] != "reflector" || dis.Labels["node"] != "node-a" || dis.Labels["app"] != "router" {
+		t.Fatalf("unexpected labels: %v", dis.Labels)
+	}
+
+	delete(pod.Annotations, "peerd.io/role")
+	if dis := e.explore(context.Background(), pod); dis != nil {
+		t.Fatalf("expected pod without role to be skipped, got %+v", dis)
+	}
+
+	pod.Annotations["peerd.io/role"] = "reflector"
+	pod.Annotations["peerd.io/port"] = "bgp"
+	if dis := e.explore(context.Background(), pod); dis != nil {
+		t.Fatalf("expected pod with invalid port to be skipped, got %+v", dis)
+	}
+}
+
+func TestExpressionConfigValidate(t *testing.T) {
+	for name, config := range map[string]expressionConfig{
+		"unclosed port":  {PortExpression: "{.metadata.name"},
+		"unclosed label": {LabelExpressions: map[string]string{"role": "{.metadata.labels"}},
+	} {
+		if err := config.validate(); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+
+	config := podExplorerConfig{
+		resourceExplorerConfig: resourceExplorerConfig{ApiServer: "https://127.0.0.1"},
+		expressionConfig:       expressionConfig{PortExpression: "{.metadata.name}"},
+		PodPortName:            "bgp",
+	}
+	if err := config.validate(); err == nil {
+		t.Errorf("expected port_expression and pod_port_name to conflict")
+	}
+}
+
+func TestExploreRemembersWhyObjectsAreSkipped(t *testing.T) {
+	e, err := newpodExplorer(&podExplorerConfig{
+		resourceExplorerConfig: resourceExplorerConfig{
+			ApiServer: "https://127.0.0.1",
+		},
+		expressionConfig: expressionConfig{
+			PortExpression: `{.metadata.annotations.peerd\.io/port}`,
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating pod explorer: %v", err)
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "router-0", Namespace: "router-system"},
+		Status:     corev1.PodStatus{PodIP: "10.0.0.1"},
+	}
+
+	for range 2 {
+		if dis := e.explore(context.Background(), pod); dis != nil {
+			t.Fatalf("expected pod without port to be skipped, got %+v", dis)
+		}
+	}
+
+	if len(e.skip) != 1 || e.skip["router-system/router-0"] == "" {
+		t.Fatalf("expected skipped pod to be remembered once, got %v", e.skip)
+	}
+
+	pod.Annotations = map[string]string{"peerd.io/port": "1179"}
+	if dis := e.explore(context.Background(), pod); dis == nil {
+		t.Fatalf("expected discovery")
+	}
+
+	if len(e.skip) != 0 {
+		t.Fatalf("expected explored pod to be forgotten, got %v", e.skip)
+	}
+}
@@ -0,0 +1,77 @@
+package kubernetes
+
+import (
+	"context"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+)
+
+// informerKey identifies what an informer watches. Explorers watching the same
+// objects through the same connection share one informer and its cache, even
+// across groups.
+type informerKey struct {
+	connection    string
+	resource      string
+	namespace     string
+	labelSelector string
+	fieldSelector string
+}
+
+type sharedInformer struct {
+	key      informerKey
+	informer cache.SharedIndexInformer
+	cancel   context.CancelFunc
+	users    int
+}
+
+var (
+	informersMu sync.Mutex
+	informers   = make(map[informerKey]*sharedInformer)
+)
+
+// acquireInformer returns the running informer for key, starting it if no
+// explorer uses it yet. The reflector of the informer relists with backoff
+// whenever its watch fails, e.g. while the API server restarts.
+func acquireInformer(key informerKey, newListWatch func() cache.ListerWatcher, object runtime.Object) *sharedInformer {
+	informersMu.Lock()
+	defer informersMu.Unlock()
+
+	if shared, ok := informers[key]; ok {
+		shared.users++
+		return shared
+	}
+
+	informer := cache.NewSharedIndexInformer(newListWatch(), object, 0, cache.Indexers{})
+	_ = informer.SetWatchErrorHandler(func(r *cache.Reflector, err error) {
+		log.Warnf("Watching kubernetes %s failed, relisting: %v", key.resource, err)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	shared := &sharedInformer{
+		key:      key,
+		informer: informer,
+		cancel:   cancel,
+		users:    1,
+	}
+	informers[key] = shared
+
+	go informer.RunWithContext(ctx)
+	return shared
+}
+
+// releaseInformer stops the informer once its last explorer released it.
+func releaseInformer(shared *sharedInformer) {
+	informersMu.Lock()
+	defer informersMu.Unlock()
+
+	shared.users--
+	if shared.users > 0 {
+		return
+	}
+
+	delete(informers, shared.key)
+	shared.cancel()
+}
@@ -0,0 +1,144 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ravenix/peerd/internal/peer"
+	"github.com/ravenix/peerd/pkg/explorer"
+	"github.com/ravenix/peerd/pkg/plugin"
+	"gopkg.in/yaml.v3"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ingressExplorer reports the addresses ingresses are reachable at, as
+// published by their ingress controller. The port is 443 for ingresses
+// terminating TLS and 80 otherwise, unless one is configured. Hostnames are
+// resolved as by the service explorer.
+type ingressExplorer struct {
+	*resourceExplorer
+	port             uint16
+	resolveHostnames bool
+}
+
+var ingressResource = resourceType{
+	name:   "ingresses",
+	object: &networkingv1.Ingress{},
+	list: func(ctx context.Context, client kubernetes.Interface, namespace string, options metav1.ListOptions) (runtime.Object, error) {
+		return client.NetworkingV1().Ingresses(namespace).List(ctx, options)
+	},
+	watch: func(ctx context.Context, client kubernetes.Interface, namespace string, options metav1.ListOptions) (watch.Interface, error) {
+		return client.NetworkingV1().Ingresses(namespace).Watch(ctx, options)
+	},
+}
+
+type ingressExplorerConfig struct {
+	resourceExplorerConfig `yaml:",inline"`
+	namespaceConfig        `yaml:",inline"`
+	expressionConfig       `yaml:",inline"`
+	Port                   uint16 `yaml:"port"`
+	ResolveHostnames       bool   `yaml:"resolve_hostnames"`
+}
+
+func ingressExplorerInitializer(yamlConfig *yaml.Node) (explorer.Explorer, error) {
+	var config ingressExplorerConfig
+	if err := plugin.DecodeConfig(yamlConfig, &config); err != nil {
+		return nil, err
+	}
+
+	e, err := newIngressExplorer(&config)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.ResolveHostnames {
+		return &polledExplorer{explorer: e}, nil
+	}
+
+	return e, nil
+}
+
+func ingressExplorerValidator(yamlConfig *yaml.Node) error {
+	var config ingressExplorerConfig
+	if err := plugin.DecodeConfig(yamlConfig, &config); err != nil {
+		return err
+	}
+
+	return config.validate()
+}
+
+func (c *ingressExplorerConfig) validate() error {
+	if err := c.resourceExplorerConfig.validate(); err != nil {
+		return err
+	}
+
+	if err := c.namespaceConfig.validate(); err != nil {
+		return err
+	}
+
+	if err := c.expressionConfig.validate(); err != nil {
+		return err
+	}
+
+	if c.PortExpression != "" && c.Port != 0 {
+		return fmt.Errorf("port_expression and port cannot be set together")
+	}
+
+	return nil
+}
+
+func newIngressExplorer(config *ingressExplorerConfig) (*ingressExplorer, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	e := &ingressExplorer{}
+	arc, err := newResourceExplorer(&config.resourceExplorerConfig, ingressResource, e.exploreIngress)
+
+	if err != nil {
+		return nil, err
+	}
+
+	e.resourceExplorer = arc
+	if e.expressions, err = config.expressions(); err != nil {
+		return nil, err
+	}
+	e.namespaces = config.namespaces()
+	e.namespaceSelector = config.NamespaceSelector
+	e.port = config.Port
+	e.resolveHostnames = config.ResolveHostnames
+	return e, nil
+}
+
+func (e *ingressExplorer) exploreIngress(ctx context.Context, resource any) *explorer.Discovery {
+	ingress, ok := resource.(*networkingv1.Ingress)
+	if !ok {
+		return nil
+	}
+
+	var addresses []peer.Address
+	for _, lb := range ingress.Status.LoadBalancer.Ingress {
+		addresses = append(addresses, loadBalancerAddresses(ctx, "ingress", ingress, lb.IP, lb.Hostname, e.resolveHostnames)...)
+	}
+
+	if len(addresses) == 0 {
+		return nil
+	}
+
+	port := e.port
+	if port == 0 {
+		port = 80
+		if len(ingress.Spec.TLS) > 0 {
+			port = 443
+		}
+	}
+
+	dis := newObjectDiscovery("ingress", ingress)
+	dis.Addresses = addresses
+	dis.Port = port
+	return dis
+}
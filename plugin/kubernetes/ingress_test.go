@@ -0,0 +1,68 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTestIngress() *networkingv1.Ingress {
+	return &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: "gateway", Namespace: "edge"},
+		Spec: networkingv1.IngressSpec{
+			TLS: []networkingv1.IngressTLS{{Hosts: []string{"gateway.example.com"}}},
+		},
+		Status: networkingv1.IngressStatus{
+			LoadBalancer: networkingv1.IngressLoadBalancerStatus{
+				Ingress: []networkingv1.IngressLoadBalancerIngress{
+					{IP: "198.51.100.20"},
+					{Hostname: "localhost"},
+				},
+			},
+		},
+	}
+}
+
+func TestExploreIngressReportsLoadBalancerAddresses(t *testing.T) {
+	e, err := newIngressExplorer(&ingressExplorerConfig{
+		resourceExplorerConfig: resourceExplorerConfig{
+			ApiServer: "https://127.0.0.1",
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating ingress explorer: %v", err)
+	}
+
+	dis := e.exploreIngress(context.Background(), newTestIngress())
+	if dis == nil {
+		t.Fatalf("expected discovery")
+	}
+
+	if dis.ID != "ingress/edge/gateway" || dis.Port != 443 {
+		t.Fatalf("unexpected discovery: %+v", dis)
+	}
+
+	if len(dis.Addresses) != 1 || dis.Addresses[0].IP.String() != "198.51.100.20" || dis.Addresses[0].Label != addressLoadBalancer {
+		t.Fatalf("expected only the load balancer IP without resolve_hostnames, got %v", dis.Addresses)
+	}
+
+	e.resolveHostnames = true
+	e.port = 8443
+	dis = e.exploreIngress(context.Background(), newTestIngress())
+	if dis == nil || dis.Port != 8443 || len(dis.Addresses) < 2 || !dis.Addresses[1].IP.IsLoopback() {
+		t.Fatalf("expected resolved hostname and configured port, got %+v", dis)
+	}
+}
+
+func TestIngressExplorerConfigValidate(t *testing.T) {
+	config := ingressExplorerConfig{
+		resourceExplorerConfig: resourceExplorerConfig{ApiServer: "https://127.0.0.1"},
+		expressionConfig:       expressionConfig{PortExpression: "{.metadata.name}"},
+		Port:                   443,
+	}
+	if err := config.validate(); err == nil {
+		t.Errorf("expected port_expression and port to conflict")
+	}
+}
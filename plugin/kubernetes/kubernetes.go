@@ -9,4 +9,14 @@ func init() {
 func setup(api plugin.PluginApi) {
 	api.RegisterExplorer("node", nodeExplorerInitializer)
 	api.RegisterExplorer("pod", podExplorerInitializer)
+	api.RegisterExplorer("endpointslice", endpointSliceExplorerInitializer)
+	api.RegisterExplorer("service", serviceExplorerInitializer)
+	api.RegisterExplorer("ingress", ingressExplorerInitializer)
+	api.RegisterExplorer("lease", leaseExplorerInitializer)
+	api.RegisterExplorerValidator("node", nodeExplorerValidator)
+	api.RegisterExplorerValidator("pod", podExplorerValidator)
+	api.RegisterExplorerValidator("endpointslice", endpointSliceExplorerValidator)
+	api.RegisterExplorerValidator("service", serviceExplorerValidator)
+	api.RegisterExplorerValidator("ingress", ingressExplorerValidator)
+	api.RegisterExplorerValidator("lease", leaseExplorerValidator)
 }
@@ -0,0 +1,386 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ravenix/peerd/internal/peer"
+	"github.com/ravenix/peerd/pkg/explorer"
+	"github.com/ravenix/peerd/pkg/plugin"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	leaseGroupLabel          = "peerd.io/group"
+	leaseAddressesAnnotation = "peerd.io/addresses"
+	leasePortAnnotation      = "peerd.io/port"
+
+	defaultLeaseDuration = 15 * time.Second
+)
+
+// leaseExplorer registers this instance with a Lease and discovers the other
+// instances of the same group by theirs, for processes which run outside of
+// the cluster and have no pod to be found by.
+type leaseExplorer struct {
+	resources     *resourceExplorer
+	namespace     string
+	group         string
+	instanceId    string
+	leaseName     string
+	addresses     []net.IP
+	port          uint16
+	leaseDuration time.Duration
+	renewInterval time.Duration
+}
+
+var leaseResource = resourceType{
+	name:   "leases",
+	object: &coordinationv1.Lease{},
+	list: func(ctx context.Context, client kubernetes.Interface, namespace string, options metav1.ListOptions) (runtime.Object, error) {
+		return client.CoordinationV1().Leases(namespace).List(ctx, options)
+	},
+	watch: func(ctx context.Context, client kubernetes.Interface, namespace string, options metav1.ListOptions) (watch.Interface, error) {
+		return client.CoordinationV1().Leases(namespace).Watch(ctx, options)
+	},
+}
+
+type leaseExplorerConfig struct {
+	resourceExplorerConfig `yaml:",inline"`
+	Namespace              string        `yaml:"namespace"`
+	Group                  string        `yaml:"group"`
+	InstanceId             string        `yaml:"instance_id"`
+	Interface              string        `yaml:"interface"`
+	IPs                    []net.IP      `yaml:"ips"`
+	Port                   uint16        `yaml:"port"`
+	LeaseDuration          time.Duration `yaml:"lease_duration"`
+	RenewInterval          time.Duration `yaml:"renew_interval"`
+}
+
+func leaseExplorerInitializer(yamlConfig *yaml.Node) (explorer.Explorer, error) {
+	var config leaseExplorerConfig
+	if err := plugin.DecodeConfig(yamlConfig, &config); err != nil {
+		return nil, err
+	}
+
+	return newLeaseExplorer(&config)
+}
+
+func leaseExplorerValidator(yamlConfig *yaml.Node) error {
+	var config leaseExplorerConfig
+	if err := plugin.DecodeConfig(yamlConfig, &config); err != nil {
+		return err
+	}
+
+	return config.validate()
+}
+
+func (c *leaseExplorerConfig) validate() error {
+	if err := c.resourceExplorerConfig.validate(); err != nil {
+		return err
+	}
+
+	if c.Namespace == "" || c.Group == "" {
+		return fmt.Errorf("namespace and group must be set")
+	}
+
+	if problems := validation.IsValidLabelValue(c.Group); len(problems) > 0 {
+		return fmt.Errorf("invalid group '%s': %s", c.Group, strings.Join(problems, ", "))
+	}
+
+	if c.InstanceId != "" {
+		if err := validateLeaseName(c.Group, c.InstanceId); err != nil {
+			return fmt.Errorf("invalid instance_id '%s': %w", c.InstanceId, err)
+		}
+	}
+
+	if (c.Interface == "") == (len(c.IPs) == 0) {
+		return fmt.Errorf("either interface or ips must be set")
+	}
+
+	if c.LeaseDuration < 0 || c.RenewInterval < 0 {
+		return fmt.Errorf("lease_duration and renew_interval must not be negative")
+	}
+
+	if c.LeaseDuration > 0 && c.LeaseDuration < time.Second {
+		return fmt.Errorf("lease_duration must be at least a second")
+	}
+
+	if c.RenewInterval > 0 && c.RenewInterval >= c.leaseDuration() {
+		return fmt.Errorf("renew_interval must be shorter than lease_duration")
+	}
+
+	return nil
+}
+
+// leaseName is the name of the lease of an instance. It includes the group, so
+// that an instance can be part of several groups in the same namespace.
+func leaseName(group string, instanceId string) string {
+	return group + "-" + instanceId
+}
+
+func validateLeaseName(group string, instanceId string) error {
+	if problems := validation.IsDNS1123Subdomain(leaseName(group, instanceId)); len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, ", "))
+	}
+
+	return nil
+}
+
+func (c *leaseExplorerConfig) leaseDuration() time.Duration {
+	if c.LeaseDuration > 0 {
+		return c.LeaseDuration
+	}
+
+	return defaultLeaseDuration
+}
+
+func newLeaseExplorer(config *leaseExplorerConfig) (*leaseExplorer, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	e := &leaseExplorer{
+		namespace:     config.Namespace,
+		group:         config.Group,
+		instanceId:    config.InstanceId,
+		addresses:     config.IPs,
+		port:          config.Port,
+		leaseDuration: config.leaseDuration(),
+		renewInterval: config.RenewInterval,
+	}
+
+	if e.renewInterval == 0 {
+		e.renewInterval = e.leaseDuration / 3
+	}
+
+	if e.instanceId == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		e.instanceId = strings.ToLower(hostname)
+
+		if err := validateLeaseName(e.group, e.instanceId); err != nil {
+			return nil, fmt.Errorf("hostname '%s' cannot be used as instance_id, set one: %w", hostname, err)
+		}
+	}
+	e.leaseName = leaseName(e.group, e.instanceId)
+
+	if config.Interface != "" {
+		addresses, err := interfaceIPs(config.Interface)
+		if err != nil {
+			return nil, err
+		}
+		e.addresses = addresses
+	}
+
+	arc, err := newResourceExplorer(&config.resourceExplorerConfig, leaseResource, e.exploreLease)
+	if err != nil {
+		return nil, err
+	}
+
+	arc.namespaces = []string{config.Namespace}
+	arc.labelSelector = leaseGroupLabel + "=" + config.Group
+	if config.LabelSelector != "" {
+		arc.labelSelector += "," + config.LabelSelector
+	}
+
+	e.resources = arc
+	return e, nil
+}
+
+func interfaceIPs(name string) ([]net.IP, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	ifaceAddrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+
+	var ips []net.IP
+	for _, addr := range ifaceAddrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.IsGlobalUnicast() {
+			ips = append(ips, ipNet.IP)
+		}
+	}
+
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no suitable IP addresses for interface %s", name)
+	}
+
+	return ips, nil
+}
+
+// Run holds the lease of this instance, renewing it until ctx is done and
+// releasing it then. Failing renewals are retried rather than ending Run, the
+// lease only expires if they keep failing.
+func (e *leaseExplorer) Run(ctx context.Context) error {
+	ticker := time.NewTicker(e.renewInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := e.renew(ctx); err != nil && ctx.Err() == nil {
+			log.Warnf("Failed renewing kubernetes lease %s/%s: %v", e.namespace, e.leaseName, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			e.release(context.WithoutCancel(ctx))
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (e *leaseExplorer) Cadence() explorer.Cadence {
+	return explorer.Cadence{
+		ExploreInterval: e.renewInterval,
+		ExploreTimeout:  e.renewInterval,
+		PeerTTL:         e.leaseDuration,
+	}
+}
+
+// Explore lists the leases of the group which have not expired.
+func (e *leaseExplorer) Explore(ctx context.Context, dh explorer.DiscoveryHandler) error {
+	return e.resources.Explore(ctx, dh)
+}
+
+func (e *leaseExplorer) renew(ctx context.Context) error {
+	leases := e.resources.k8sClient.CoordinationV1().Leases(e.namespace)
+	now := metav1.NewMicroTime(time.Now())
+
+	lease, err := leases.Get(ctx, e.leaseName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: e.leaseName, Namespace: e.namespace},
+		}
+		e.updateLease(lease, now)
+		_, err = leases.Create(ctx, lease, metav1.CreateOptions{})
+		return err
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !e.holds(lease) && !leaseExpired(lease, now.Time) {
+		return fmt.Errorf("lease is held by '%s'", ptr.Deref(lease.Spec.HolderIdentity, ""))
+	}
+
+	e.updateLease(lease, now)
+	_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	return err
+}
+
+func (e *leaseExplorer) updateLease(lease *coordinationv1.Lease, now metav1.MicroTime) {
+	addresses := make([]string, 0, len(e.addresses))
+	for _, address := range e.addresses {
+		addresses = append(addresses, address.String())
+	}
+
+	if lease.Labels == nil {
+		lease.Labels = make(map[string]string)
+	}
+	lease.Labels[leaseGroupLabel] = e.group
+
+	if lease.Annotations == nil {
+		lease.Annotations = make(map[string]string)
+	}
+	lease.Annotations[leaseAddressesAnnotation] = strings.Join(addresses, ",")
+	lease.Annotations[leasePortAnnotation] = strconv.Itoa(int(e.port))
+
+	if !e.holds(lease) || lease.Spec.AcquireTime == nil {
+		lease.Spec.AcquireTime = &now
+	}
+
+	lease.Spec.HolderIdentity = ptr.To(e.instanceId)
+	lease.Spec.LeaseDurationSeconds = ptr.To(int32(e.leaseDuration / time.Second))
+	lease.Spec.RenewTime = &now
+}
+
+func (e *leaseExplorer) holds(lease *coordinationv1.Lease) bool {
+	return ptr.Deref(lease.Spec.HolderIdentity, "") == e.instanceId
+}
+
+// release deletes the lease so that the other instances lose this one right
+// away instead of once it expired. A lease which was taken over in the
+// meantime is left alone.
+func (e *leaseExplorer) release(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, e.renewInterval)
+	defer cancel()
+
+	leases := e.resources.k8sClient.CoordinationV1().Leases(e.namespace)
+	lease, err := leases.Get(ctx, e.leaseName, metav1.GetOptions{})
+	if err == nil && e.holds(lease) {
+		err = leases.Delete(ctx, e.leaseName, metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{UID: &lease.UID, ResourceVersion: &lease.ResourceVersion},
+		})
+	}
+
+	if err != nil && !apierrors.IsNotFound(err) {
+		log.Warnf("Failed releasing kubernetes lease %s/%s: %v", e.namespace, e.leaseName, err)
+	}
+}
+
+func (e *leaseExplorer) exploreLease(ctx context.Context, resource any) *explorer.Discovery {
+	lease, ok := resource.(*coordinationv1.Lease)
+	if !ok || lease.Name == e.leaseName {
+		return nil
+	}
+
+	if leaseExpired(lease, time.Now()) {
+		log.Debugf("skipping expired lease %s/%s", lease.Namespace, lease.Name)
+		return nil
+	}
+
+	var addresses []peer.Address
+	for _, address := range strings.Split(lease.Annotations[leaseAddressesAnnotation], ",") {
+		if ipAddr := net.ParseIP(address); ipAddr != nil {
+			addresses = append(addresses, peer.NewAddress(ipAddr))
+		}
+	}
+
+	if len(addresses) == 0 {
+		return nil
+	}
+
+	port, err := strconv.ParseUint(lease.Annotations[leasePortAnnotation], 10, 16)
+	if err != nil {
+		log.Debugf("skipping lease %s/%s with invalid port '%s'", lease.Namespace, lease.Name, lease.Annotations[leasePortAnnotation])
+		return nil
+	}
+
+	dis := newObjectDiscovery("lease", lease)
+	if holder := ptr.Deref(lease.Spec.HolderIdentity, ""); holder != "" {
+		dis.Name = holder
+	}
+	dis.Addresses = addresses
+	dis.Port = uint16(port)
+	return dis
+}
+
+func leaseExpired(lease *coordinationv1.Lease, now time.Time) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+
+	duration := time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second
+	return lease.Spec.RenewTime.Add(duration).Before(now)
+}
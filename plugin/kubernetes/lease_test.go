@@ -0,0 +1,182 @@
+package kubernetes
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ravenix/peerd/pkg/explorer"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/ptr"
+)
+
+type testDiscoveryHandler []*explorer.Discovery
+
+func (h *testDiscoveryHandler) Discovered(d *explorer.Discovery) { *h = append(*h, d) }
+
+func newFakeLeaseExplorer(t *testing.T, client *fake.Clientset, instanceId string, group string, ip string) *leaseExplorer {
+	e, err := newLeaseExplorer(&leaseExplorerConfig{
+		resourceExplorerConfig: resourceExplorerConfig{
+			ApiServer: "https://127.0.0.1",
+		},
+		Namespace:     "peerd",
+		Group:         group,
+		InstanceId:    instanceId,
+		IPs:           []net.IP{net.ParseIP(ip)},
+		Port:          179,
+		LeaseDuration: 10 * time.Second,
+		RenewInterval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating lease explorer: %v", err)
+	}
+
+	e.resources.k8sClient = client
+	return e
+}
+
+// waitForRenewedLease waits until the lease has been renewed at least once
+// after it was acquired.
+func waitForRenewedLease(t *testing.T, client *fake.Clientset, name string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		lease, err := client.CoordinationV1().Leases("peerd").Get(context.Background(), name, metav1.GetOptions{})
+		if err == nil && lease.Spec.RenewTime != nil && lease.Spec.RenewTime.After(lease.Spec.AcquireTime.Time) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("lease %s was not renewed: %+v, %v", name, lease, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLeaseExplorerRegistersAndDiscoversInstances(t *testing.T) {
+	client := fake.NewClientset(&coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "edge-gateway-c",
+			Namespace:   "peerd",
+			Labels:      map[string]string{leaseGroupLabel: "edge"},
+			Annotations: map[string]string{leaseAddressesAnnotation: "10.0.0.3", leasePortAnnotation: "179"},
+		},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       ptr.To("gateway-c"),
+			LeaseDurationSeconds: ptr.To(int32(10)),
+			RenewTime:            &metav1.MicroTime{Time: time.Now().Add(-time.Minute)},
+		},
+	})
+
+	a := newFakeLeaseExplorer(t, client, "gateway-a", "edge", "10.0.0.1")
+	b := newFakeLeaseExplorer(t, client, "gateway-b", "edge", "fd00::2")
+	other := newFakeLeaseExplorer(t, client, "gateway-a", "core", "10.0.0.1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	for _, e := range []*leaseExplorer{a, b, other} {
+		go func() {
+			_ = e.Run(ctx)
+			done <- struct{}{}
+		}()
+	}
+
+	for _, name := range []string{"edge-gateway-a", "edge-gateway-b", "core-gateway-a"} {
+		waitForRenewedLease(t, client, name)
+	}
+
+	var dh testDiscoveryHandler
+	if err := a.Explore(context.Background(), &dh); err != nil {
+		t.Fatalf("unexpected error exploring leases: %v", err)
+	}
+
+	if len(dh) != 1 || dh[0].ID != "lease/peerd/edge-gateway-b" || dh[0].Name != "gateway-b" || dh[0].Port != 179 {
+		t.Fatalf("expected only the lease of gateway-b, got %+v", dh)
+	}
+
+	if len(dh[0].Addresses) != 1 || dh[0].Addresses[0].IP.String() != "fd00::2" {
+		t.Fatalf("unexpected addresses: %v", dh[0].Addresses)
+	}
+
+	cancel()
+	for range 3 {
+		<-done
+	}
+
+	leases := client.CoordinationV1().Leases("peerd")
+	for _, name := range []string{"edge-gateway-a", "edge-gateway-b", "core-gateway-a"} {
+		if _, err := leases.Get(context.Background(), name, metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+			t.Fatalf("expected lease %s to be released, got %v", name, err)
+		}
+	}
+}
+
+func TestLeaseExplorerDoesNotTakeOverHeldLease(t *testing.T) {
+	renewed := time.Now()
+	client := fake.NewClientset(&coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: "edge-gateway-a", Namespace: "peerd"},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       ptr.To("other-host"),
+			LeaseDurationSeconds: ptr.To(int32(10)),
+			RenewTime:            &metav1.MicroTime{Time: renewed},
+		},
+	})
+
+	e := newFakeLeaseExplorer(t, client, "gateway-a", "edge", "10.0.0.1")
+	if err := e.renew(context.Background()); err == nil {
+		t.Fatalf("expected renewing a lease held by another instance to fail")
+	}
+
+	e.release(context.Background())
+
+	lease, err := client.CoordinationV1().Leases("peerd").Get(context.Background(), "edge-gateway-a", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected lease of the other instance to be kept, got %v", err)
+	}
+
+	if *lease.Spec.HolderIdentity != "other-host" || !lease.Spec.RenewTime.Time.Equal(renewed) {
+		t.Fatalf("expected lease of the other instance to be untouched, got %+v", lease.Spec)
+	}
+
+	lease.Spec.RenewTime = &metav1.MicroTime{Time: renewed.Add(-time.Minute)}
+	if _, err := client.CoordinationV1().Leases("peerd").Update(context.Background(), lease, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("unexpected error expiring lease: %v", err)
+	}
+
+	if err := e.renew(context.Background()); err != nil {
+		t.Fatalf("expected expired lease to be taken over, got %v", err)
+	}
+}
+
+func TestLeaseExplorerConfigValidate(t *testing.T) {
+	valid := leaseExplorerConfig{
+		resourceExplorerConfig: resourceExplorerConfig{ApiServer: "https://127.0.0.1"},
+		Namespace:              "peerd",
+		Group:                  "edge",
+		IPs:                    []net.IP{net.ParseIP("10.0.0.1")},
+	}
+
+	if err := valid.validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+
+	for name, modify := range map[string]func(c *leaseExplorerConfig){
+		"missing group":       func(c *leaseExplorerConfig) { c.Group = "" },
+		"invalid group":       func(c *leaseExplorerConfig) { c.Group = "edge/a" },
+		"invalid instance id": func(c *leaseExplorerConfig) { c.InstanceId = "Gateway_A" },
+		"invalid lease name":  func(c *leaseExplorerConfig) { c.Group = "Edge"; c.InstanceId = "gateway-a" },
+		"no addresses":        func(c *leaseExplorerConfig) { c.IPs = nil },
+		"interface and ips":   func(c *leaseExplorerConfig) { c.Interface = "eth0" },
+		"renew too slow":      func(c *leaseExplorerConfig) { c.RenewInterval = time.Minute },
+	} {
+		config := valid
+		modify(&config)
+		if err := config.validate(); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/ravenix/peerd/pkg/explorer"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+var namespaceResource = resourceType{
+	name:   "namespaces",
+	object: &corev1.Namespace{},
+	list: func(ctx context.Context, client kubernetes.Interface, _ string, options metav1.ListOptions) (runtime.Object, error) {
+		return client.CoreV1().Namespaces().List(ctx, options)
+	},
+	watch: func(ctx context.Context, client kubernetes.Interface, _ string, options metav1.ListOptions) (watch.Interface, error) {
+		return client.CoreV1().Namespaces().Watch(ctx, options)
+	},
+}
+
+// namespaceConfig selects the namespaces objects are watched in: the listed
+// ones as well as those matching the selector. Without either, all namespaces
+// are watched.
+type namespaceConfig struct {
+	Namespace         string   `yaml:"namespace"`
+	Namespaces        []string `yaml:"namespaces"`
+	NamespaceSelector string   `yaml:"namespace_selector"`
+}
+
+func (c *namespaceConfig) validate() error {
+	if _, err := labels.Parse(c.NamespaceSelector); err != nil {
+		return fmt.Errorf("invalid namespace_selector: %w", err)
+	}
+
+	if slices.Contains(c.Namespaces, "") {
+		return fmt.Errorf("namespaces must not be empty")
+	}
+
+	return nil
+}
+
+func (c *namespaceConfig) namespaces() []string {
+	var namespaces []string
+	for _, namespace := range append([]string{c.Namespace}, c.Namespaces...) {
+		if namespace != "" && !slices.Contains(namespaces, namespace) {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+
+	return namespaces
+}
+
+// watchedNamespaces are the namespaces which are always watched. The empty
+// namespace stands for all of them.
+func (e *resourceExplorer) watchedNamespaces() []string {
+	if len(e.namespaces) == 0 && e.namespaceSelector == "" {
+		return []string{""}
+	}
+
+	return e.namespaces
+}
+
+// streamSelectedNamespaces streams the listed namespaces and, as they are
+// created, deleted or relabelled, those matching the namespace selector.
+func (e *resourceExplorer) streamSelectedNamespaces(ctx context.Context, events explorer.EventHandler) error {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	streams := make(map[string]chan struct{})
+
+	start := func(namespace string) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if _, ok := streams[namespace]; ok || ctx.Err() != nil {
+			return
+		}
+
+		stop := make(chan struct{})
+		streams[namespace] = stop
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = e.streamNamespace(ctx, stop, namespace, events)
+		}()
+	}
+
+	stop := func(namespace string) {
+		if slices.Contains(e.namespaces, namespace) {
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if ch, ok := streams[namespace]; ok {
+			close(ch)
+			delete(streams, namespace)
+		}
+	}
+
+	for _, namespace := range e.namespaces {
+		start(namespace)
+	}
+
+	shared := e.acquireInformer(namespaceResource, "", e.namespaceSelector, "")
+	defer releaseInformer(shared)
+
+	registration, err := shared.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) {
+			if namespace, ok := obj.(*corev1.Namespace); ok {
+				start(namespace.Name)
+			}
+		},
+		DeleteFunc: func(obj any) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+
+			if namespace, ok := obj.(*corev1.Namespace); ok {
+				stop(namespace.Name)
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	<-ctx.Done()
+	_ = shared.informer.RemoveEventHandler(registration)
+
+	mu.Lock()
+	for namespace, ch := range streams {
+		close(ch)
+		delete(streams, namespace)
+	}
+	mu.Unlock()
+
+	wg.Wait()
+	return nil
+}
+
+func (e *resourceExplorer) listSelectedNamespaces(ctx context.Context) ([]string, error) {
+	list, err := e.k8sClient.CoreV1().Namespaces().List(ctx, metav1.ListOptions{LabelSelector: e.namespaceSelector})
+	if err != nil {
+		return nil, err
+	}
+
+	var namespaces []string
+	for _, namespace := range list.Items {
+		if !slices.Contains(e.namespaces, namespace.Name) {
+			namespaces = append(namespaces, namespace.Name)
+		}
+	}
+
+	return namespaces, nil
+}
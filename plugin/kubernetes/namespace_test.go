@@ -0,0 +1,70 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTestPod(namespace string, name string, address string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Status:     corev1.PodStatus{PodIP: address},
+	}
+}
+
+func TestStreamFollowsSelectedNamespaces(t *testing.T) {
+	e, err := newpodExplorer(&podExplorerConfig{
+		resourceExplorerConfig: resourceExplorerConfig{
+			ApiServer: "https://" + t.Name(),
+		},
+		namespaceConfig: namespaceConfig{
+			NamespaceSelector: "peering=true",
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating pod explorer: %v", err)
+	}
+
+	client, watching := newFakeClientset("namespaces",
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "edge-a", Labels: map[string]string{"peering": "true"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "other"}},
+		newTestPod("edge-a", "router-0", "10.0.0.1"),
+		newTestPod("other", "router-0", "10.0.1.1"),
+	)
+	e.k8sClient = client
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := make(testEventHandler, 10)
+	go func() { _ = e.Stream(ctx, events) }()
+
+	ev := events.next(t)
+	if ev.kind != "added" || ev.discovery.ID != "pod/edge-a/router-0" || ev.discovery.Labels[labelNamespace] != "edge-a" {
+		t.Fatalf("unexpected event: %+v", ev)
+	}
+	<-watching
+
+	if _, err := client.CoreV1().Pods("edge-b").Create(ctx, newTestPod("edge-b", "router-0", "10.0.2.1"), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "edge-b", Labels: map[string]string{"peering": "true"}}}
+	if _, err := client.CoreV1().Namespaces().Create(ctx, namespace, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if ev := events.next(t); ev.kind != "added" || ev.discovery.ID != "pod/edge-b/router-0" {
+		t.Fatalf("unexpected event: %+v", ev)
+	}
+
+	if err := client.CoreV1().Namespaces().Delete(ctx, "edge-a", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if ev := events.next(t); ev.kind != "removed" || ev.discovery.ID != "pod/edge-a/router-0" {
+		t.Fatalf("unexpected event: %+v", ev)
+	}
+}
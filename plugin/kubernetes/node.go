@@ -2,89 +2,304 @@ package kubernetes
 
 import (
 	"context"
+	"fmt"
 	"net"
+	"strconv"
+	"strings"
 
+	"github.com/ravenix/peerd/internal/peer"
 	"github.com/ravenix/peerd/pkg/explorer"
+	"github.com/ravenix/peerd/pkg/plugin"
+	log "github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v3"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
 )
 
 type nodeExplorer struct {
 	*resourceExplorer
-	addressType corev1.NodeAddressType
-	nodePort    uint16
+	addressTypes         []corev1.NodeAddressType
+	nodePort             uint16
+	portAnnotation       string
+	portLabel            string
+	requiredConditions   map[corev1.NodeConditionType]corev1.ConditionStatus
+	excludeUnschedulable bool
+	excludeTaints        []nodeTaint
+}
+
+// nodeTaint matches the taints of a node in the notation of kubectl taint,
+// key[=value][:effect]. An empty value or effect matches any.
+type nodeTaint struct {
+	key    string
+	value  string
+	effect corev1.TaintEffect
+}
+
+var nodeResource = resourceType{
+	name:   "nodes",
+	object: &corev1.Node{},
+	list: func(ctx context.Context, client kubernetes.Interface, _ string, options metav1.ListOptions) (runtime.Object, error) {
+		return client.CoreV1().Nodes().List(ctx, options)
+	},
+	watch: func(ctx context.Context, client kubernetes.Interface, _ string, options metav1.ListOptions) (watch.Interface, error) {
+		return client.CoreV1().Nodes().Watch(ctx, options)
+	},
 }
 
 type nodeExplorerConfig struct {
 	resourceExplorerConfig `yaml:",inline"`
-	AddressType            corev1.NodeAddressType
-	NodePort               uint16 `yaml:"node_port"`
+	expressionConfig       `yaml:",inline"`
+	AddressType            corev1.NodeAddressType   `yaml:"address_type"`
+	AddressTypes           []corev1.NodeAddressType `yaml:"address_types"`
+	NodePort               uint16                   `yaml:"node_port"`
+	PortAnnotation         string                   `yaml:"port_annotation"`
+	PortLabel              string                   `yaml:"port_label"`
+
+	// LegacyAddressType is the former name of address_type.
+	LegacyAddressType corev1.NodeAddressType `yaml:"addresstype"`
+
+	RequiredConditions   map[corev1.NodeConditionType]corev1.ConditionStatus `yaml:"required_conditions"`
+	ExcludeUnschedulable bool                                                `yaml:"exclude_unschedulable"`
+	ExcludeTaints        []string                                            `yaml:"exclude_taints"`
 }
 
 func nodeExplorerInitializer(yamlConfig *yaml.Node) (explorer.Explorer, error) {
 	var config nodeExplorerConfig
-	if err := yamlConfig.Decode(&config); err != nil {
+	if err := plugin.DecodeConfig(yamlConfig, &config); err != nil {
 		return nil, err
 	}
+	config.migrate()
 
 	return newNodeExplorer(&config)
 }
 
+func nodeExplorerValidator(yamlConfig *yaml.Node) error {
+	var config nodeExplorerConfig
+	if err := plugin.DecodeConfig(yamlConfig, &config); err != nil {
+		return err
+	}
+	config.migrate()
+
+	return config.validate()
+}
+
+// migrate moves the keys of the configuration which were renamed to their
+// current name. A key set under both names is left for validate to reject.
+func (c *nodeExplorerConfig) migrate() {
+	if c.LegacyAddressType == "" {
+		return
+	}
+
+	log.Warn("Kubernetes node explorer: addresstype is deprecated, use address_type instead")
+	if c.AddressType == "" {
+		c.AddressType, c.LegacyAddressType = c.LegacyAddressType, ""
+	}
+}
+
+func (c *nodeExplorerConfig) validate() error {
+	if err := c.resourceExplorerConfig.validate(); err != nil {
+		return err
+	}
+
+	if c.LegacyAddressType != "" {
+		return fmt.Errorf("addresstype and address_type cannot be set together")
+	}
+
+	for _, addressType := range append([]corev1.NodeAddressType{c.AddressType}, c.AddressTypes...) {
+		switch addressType {
+		case "", corev1.NodeHostName, corev1.NodeInternalIP, corev1.NodeExternalIP, corev1.NodeInternalDNS, corev1.NodeExternalDNS:
+		default:
+			return fmt.Errorf("unknown address type '%s'", addressType)
+		}
+	}
+
+	if err := c.expressionConfig.validate(); err != nil {
+		return err
+	}
+
+	if c.PortAnnotation != "" && c.PortLabel != "" {
+		return fmt.Errorf("port_annotation and port_label cannot be set together")
+	}
+
+	if c.PortExpression != "" && (c.PortAnnotation != "" || c.PortLabel != "") {
+		return fmt.Errorf("port_expression cannot be set together with port_annotation or port_label")
+	}
+
+	for conditionType, status := range c.RequiredConditions {
+		switch status {
+		case corev1.ConditionTrue, corev1.ConditionFalse, corev1.ConditionUnknown:
+		default:
+			return fmt.Errorf("unknown status '%s' of node condition '%s'", status, conditionType)
+		}
+	}
+
+	for _, taint := range c.ExcludeTaints {
+		if _, err := parseNodeTaint(taint); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func parseNodeTaint(taint string) (nodeTaint, error) {
+	var t nodeTaint
+	spec, effect, hasEffect := strings.Cut(taint, ":")
+	t.key, t.value, _ = strings.Cut(spec, "=")
+
+	if t.key == "" {
+		return t, fmt.Errorf("invalid taint '%s', expected key[=value][:effect]", taint)
+	}
+
+	if hasEffect {
+		t.effect = corev1.TaintEffect(effect)
+		switch t.effect {
+		case corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+		default:
+			return t, fmt.Errorf("unknown effect '%s' of taint '%s'", effect, taint)
+		}
+	}
+
+	return t, nil
+}
+
+func (t nodeTaint) matches(taint corev1.Taint) bool {
+	return taint.Key == t.key && (t.value == "" || taint.Value == t.value) && (t.effect == "" || taint.Effect == t.effect)
+}
+
 func newNodeExplorer(config *nodeExplorerConfig) (*nodeExplorer, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
 	e := &nodeExplorer{}
-	arc, err := newResourceExplorer(&config.resourceExplorerConfig, e.listNodes, e.exploreNode)
+	arc, err := newResourceExplorer(&config.resourceExplorerConfig, nodeResource, e.exploreNode)
 
 	if err != nil {
 		return nil, err
 	}
 
 	e.resourceExplorer = arc
+	if e.expressions, err = config.expressions(); err != nil {
+		return nil, err
+	}
 
 	if config.AddressType != "" {
-		e.addressType = config.AddressType
-	} else {
-		e.addressType = corev1.NodeInternalIP
+		e.addressTypes = append(e.addressTypes, config.AddressType)
 	}
 
-	e.nodePort = config.NodePort
-	return e, nil
-}
+	e.addressTypes = append(e.addressTypes, config.AddressTypes...)
 
-func (e *nodeExplorer) listNodes(ctx context.Context) ([]any, error) {
-	list, err := e.k8sClient.CoreV1().Nodes().List(ctx, e.newListOptions())
-	if err != nil {
-		return nil, err
+	if len(e.addressTypes) == 0 {
+		e.addressTypes = []corev1.NodeAddressType{corev1.NodeInternalIP}
 	}
 
-	var items []any
-	for idx := range list.Items {
-		items = append(items, &list.Items[idx])
+	for _, taint := range config.ExcludeTaints {
+		t, err := parseNodeTaint(taint)
+		if err != nil {
+			return nil, err
+		}
+		e.excludeTaints = append(e.excludeTaints, t)
 	}
 
-	return items, nil
+	e.nodePort = config.NodePort
+	e.portAnnotation = config.PortAnnotation
+	e.portLabel = config.PortLabel
+	e.requiredConditions = config.RequiredConditions
+	e.excludeUnschedulable = config.ExcludeUnschedulable
+	return e, nil
 }
 
 func (e *nodeExplorer) exploreNode(ctx context.Context, resource any) *explorer.Discovery {
 	node, ok := resource.(*corev1.Node)
+	if !ok || !e.includeNode(node) {
+		return nil
+	}
+
+	port, ok := e.port(node)
 	if !ok {
 		return nil
 	}
 
-	for _, nodeAddr := range node.Status.Addresses {
-		if ipAddr := net.ParseIP(nodeAddr.Address); ipAddr != nil && nodeAddr.Type == e.addressType {
-			dis := &explorer.Discovery{
-				Port: e.nodePort,
+	var addresses []peer.Address
+	for _, addressType := range e.addressTypes {
+		for _, nodeAddr := range node.Status.Addresses {
+			if ipAddr := net.ParseIP(nodeAddr.Address); ipAddr != nil && nodeAddr.Type == addressType {
+				address := peer.NewAddress(ipAddr)
+				address.Label = string(nodeAddr.Type)
+				addresses = append(addresses, address)
 			}
+		}
+	}
 
-			if ipAddr.To4() != nil {
-				dis.IPv4Addr = ipAddr
-			} else {
-				dis.IPv6Addr = ipAddr
+	if len(addresses) == 0 {
+		return nil
+	}
+
+	dis := newObjectDiscovery("node", node)
+	dis.Addresses = addresses
+	dis.Port = port
+	return dis
+}
+
+// includeNode applies the filters on the conditions, scheduling and taints of
+// the node.
+func (e *nodeExplorer) includeNode(node *corev1.Node) bool {
+	if e.excludeUnschedulable && node.Spec.Unschedulable {
+		return false
+	}
+
+	for conditionType, status := range e.requiredConditions {
+		if nodeCondition(node, conditionType) != status {
+			return false
+		}
+	}
+
+	for _, taint := range node.Spec.Taints {
+		for _, excluded := range e.excludeTaints {
+			if excluded.matches(taint) {
+				return false
 			}
+		}
+	}
+
+	return true
+}
 
-			return dis
+func nodeCondition(node *corev1.Node, conditionType corev1.NodeConditionType) corev1.ConditionStatus {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == conditionType {
+			return condition.Status
 		}
 	}
 
-	return nil
+	return corev1.ConditionUnknown
+}
+
+// port reads the port of the node from its annotation or label, falling back
+// to the configured port when the node does not carry one.
+func (e *nodeExplorer) port(node *corev1.Node) (uint16, bool) {
+	var value string
+	var found bool
+	switch {
+	case e.portAnnotation != "":
+		value, found = node.Annotations[e.portAnnotation]
+	case e.portLabel != "":
+		value, found = node.Labels[e.portLabel]
+	}
+
+	if !found {
+		return e.nodePort, true
+	}
+
+	port, err := strconv.ParseUint(value, 10, 16)
+	if err != nil {
+		log.Debugf("skipping node %s with invalid port '%s'", node.Name, value)
+		return 0, false
+	}
+
+	return uint16(port), true
 }
@@ -0,0 +1,189 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestExploreNodeReportsAddressesOfConfiguredTypes(t *testing.T) {
+	e, err := newNodeExplorer(&nodeExplorerConfig{
+		resourceExplorerConfig: resourceExplorerConfig{
+			ApiServer: "https://127.0.0.1",
+		},
+		AddressTypes: []corev1.NodeAddressType{corev1.NodeInternalIP, corev1.NodeExternalIP},
+		NodePort:     179,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating node explorer: %v", err)
+	}
+
+	dis := e.exploreNode(context.Background(), &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-a"},
+		Status: corev1.NodeStatus{
+			Addresses: []corev1.NodeAddress{
+				{Type: corev1.NodeHostName, Address: "node-a"},
+				{Type: corev1.NodeInternalIP, Address: "10.0.0.1"},
+				{Type: corev1.NodeInternalIP, Address: "fd00::1"},
+				{Type: corev1.NodeExternalIP, Address: "192.0.2.1"},
+			},
+		},
+	})
+	if dis == nil {
+		t.Fatalf("expected discovery")
+	}
+
+	if dis.ID != "node/node-a" || dis.Port != 179 {
+		t.Fatalf("unexpected discovery: %+v", dis)
+	}
+
+	if len(dis.Addresses) != 3 {
+		t.Fatalf("expected three addresses, got %v", dis.Addresses)
+	}
+
+	if dis.Addresses[2].Label != string(corev1.NodeExternalIP) {
+		t.Fatalf("unexpected address label: %q", dis.Addresses[2].Label)
+	}
+}
+
+func TestNewNodeExplorerDefaultsToInternalIP(t *testing.T) {
+	e, err := newNodeExplorer(&nodeExplorerConfig{
+		resourceExplorerConfig: resourceExplorerConfig{
+			ApiServer: "https://127.0.0.1",
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating node explorer: %v", err)
+	}
+
+	if len(e.addressTypes) != 1 || e.addressTypes[0] != corev1.NodeInternalIP {
+		t.Fatalf("unexpected address types: %v", e.addressTypes)
+	}
+}
+
+func TestExploreNodeAppliesFilters(t *testing.T) {
+	e, err := newNodeExplorer(&nodeExplorerConfig{
+		resourceExplorerConfig: resourceExplorerConfig{
+			ApiServer: "https://127.0.0.1",
+		},
+		RequiredConditions:   map[corev1.NodeConditionType]corev1.ConditionStatus{corev1.NodeReady: corev1.ConditionTrue},
+		ExcludeUnschedulable: true,
+		ExcludeTaints:        []string{"node.kubernetes.io/out-of-service", "role=gateway:NoSchedule"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating node explorer: %v", err)
+	}
+
+	newNode := func() *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-a"},
+			Status: corev1.NodeStatus{
+				Addresses:  []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.0.1"}},
+				Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}},
+			},
+		}
+	}
+
+	notReady := newNode()
+	notReady.Status.Conditions[0].Status = corev1.ConditionFalse
+
+	cordoned := newNode()
+	cordoned.Spec.Unschedulable = true
+
+	outOfService := newNode()
+	outOfService.Spec.Taints = []corev1.Taint{{Key: "node.kubernetes.io/out-of-service", Effect: corev1.TaintEffectNoExecute}}
+
+	gateway := newNode()
+	gateway.Spec.Taints = []corev1.Taint{{Key: "role", Value: "gateway", Effect: corev1.TaintEffectNoSchedule}}
+
+	otherEffect := newNode()
+	otherEffect.Spec.Taints = []corev1.Taint{{Key: "role", Value: "gateway", Effect: corev1.TaintEffectPreferNoSchedule}}
+
+	for name, tc := range map[string]struct {
+		node     *corev1.Node
+		included bool
+	}{
+		"ready":          {newNode(), true},
+		"not ready":      {notReady, false},
+		"unschedulable":  {cordoned, false},
+		"excluded taint": {outOfService, false},
+		"taint value":    {gateway, false},
+		"other effect":   {otherEffect, true},
+	} {
+		if dis := e.exploreNode(context.Background(), tc.node); (dis != nil) != tc.included {
+			t.Errorf("%s: expected included=%v, got %+v", name, tc.included, dis)
+		}
+	}
+}
+
+func TestExploreNodeReadsPortFromAnnotation(t *testing.T) {
+	e, err := newNodeExplorer(&nodeExplorerConfig{
+		resourceExplorerConfig: resourceExplorerConfig{
+			ApiServer: "https://127.0.0.1",
+		},
+		NodePort:       179,
+		PortAnnotation: "peerd.io/port",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating node explorer: %v", err)
+	}
+
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-a"},
+		Status: corev1.NodeStatus{
+			Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.0.1"}},
+		},
+	}
+
+	if dis := e.exploreNode(context.Background(), node); dis == nil || dis.Port != 179 {
+		t.Fatalf("expected the configured port without annotation, got %+v", dis)
+	}
+
+	node.Annotations = map[string]string{"peerd.io/port": "1179"}
+	if dis := e.exploreNode(context.Background(), node); dis == nil || dis.Port != 1179 {
+		t.Fatalf("expected the annotated port, got %+v", dis)
+	}
+
+	node.Annotations["peerd.io/port"] = "bgp"
+	if dis := e.exploreNode(context.Background(), node); dis != nil {
+		t.Fatalf("expected node with invalid port to be skipped, got %+v", dis)
+	}
+}
+
+func TestNodeExplorerConfigAcceptsFormerAddressTypeKey(t *testing.T) {
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte("api_server: https://127.0.0.1\naddresstype: ExternalIP\n"), &node); err != nil {
+		t.Fatalf("unexpected error parsing configuration: %v", err)
+	}
+
+	if err := nodeExplorerValidator(&node); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+
+	e, err := nodeExplorerInitializer(&node)
+	if err != nil {
+		t.Fatalf("unexpected error creating node explorer: %v", err)
+	}
+
+	if addressTypes := e.(*nodeExplorer).addressTypes; len(addressTypes) != 1 || addressTypes[0] != corev1.NodeExternalIP {
+		t.Fatalf("unexpected address types: %v", addressTypes)
+	}
+}
+
+func TestNodeExplorerConfigValidate(t *testing.T) {
+	for name, config := range map[string]nodeExplorerConfig{
+		"port annotation and label": {PortAnnotation: "a", PortLabel: "b"},
+		"condition status":          {RequiredConditions: map[corev1.NodeConditionType]corev1.ConditionStatus{corev1.NodeReady: "Yes"}},
+		"taint without key":         {ExcludeTaints: []string{"=value"}},
+		"taint effect":              {ExcludeTaints: []string{"key:Sometimes"}},
+		"address type twice":        {AddressType: corev1.NodeInternalIP, LegacyAddressType: corev1.NodeExternalIP},
+	} {
+		config.ApiServer = "https://127.0.0.1"
+		if err := config.validate(); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+}
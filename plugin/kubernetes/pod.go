@@ -2,81 +2,191 @@ package kubernetes
 
 import (
 	"context"
+	"fmt"
 	"net"
 
+	"github.com/ravenix/peerd/internal/peer"
 	"github.com/ravenix/peerd/pkg/explorer"
+	"github.com/ravenix/peerd/pkg/plugin"
+	log "github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v3"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
 )
 
 type podExplorer struct {
 	*resourceExplorer
-	namespace string
-	podPort   uint16
+	podPort            uint16
+	podPortName        string
+	requireReady       bool
+	readinessGate      corev1.PodConditionType
+	excludeTerminating bool
+}
+
+var podResource = resourceType{
+	name:   "pods",
+	object: &corev1.Pod{},
+	list: func(ctx context.Context, client kubernetes.Interface, namespace string, options metav1.ListOptions) (runtime.Object, error) {
+		return client.CoreV1().Pods(namespace).List(ctx, options)
+	},
+	watch: func(ctx context.Context, client kubernetes.Interface, namespace string, options metav1.ListOptions) (watch.Interface, error) {
+		return client.CoreV1().Pods(namespace).Watch(ctx, options)
+	},
 }
 
 type podExplorerConfig struct {
 	resourceExplorerConfig `yaml:",inline"`
-	Namespace              string `yaml:"namespace"`
+	namespaceConfig        `yaml:",inline"`
+	expressionConfig       `yaml:",inline"`
 	PodPort                uint16 `yaml:"pod_port"`
+	PodPortName            string `yaml:"pod_port_name"`
+	RequireReady           bool   `yaml:"require_ready"`
+	ReadinessGate          string `yaml:"readiness_gate"`
+	ExcludeTerminating     bool   `yaml:"exclude_terminating"`
 }
 
 func podExplorerInitializer(yamlConfig *yaml.Node) (explorer.Explorer, error) {
 	var config podExplorerConfig
-	if err := yamlConfig.Decode(&config); err != nil {
+	if err := plugin.DecodeConfig(yamlConfig, &config); err != nil {
 		return nil, err
 	}
 
 	return newpodExplorer(&config)
 }
 
+func podExplorerValidator(yamlConfig *yaml.Node) error {
+	var config podExplorerConfig
+	if err := plugin.DecodeConfig(yamlConfig, &config); err != nil {
+		return err
+	}
+
+	return config.validate()
+}
+
+func (c *podExplorerConfig) validate() error {
+	if err := c.resourceExplorerConfig.validate(); err != nil {
+		return err
+	}
+
+	if err := c.namespaceConfig.validate(); err != nil {
+		return err
+	}
+
+	if err := c.expressionConfig.validate(); err != nil {
+		return err
+	}
+
+	if c.PodPort != 0 && c.PodPortName != "" {
+		return fmt.Errorf("pod_port and pod_port_name cannot be set together")
+	}
+
+	if c.PortExpression != "" && c.PodPortName != "" {
+		return fmt.Errorf("port_expression and pod_port_name cannot be set together")
+	}
+
+	return nil
+}
+
 func newpodExplorer(config *podExplorerConfig) (*podExplorer, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
 	e := &podExplorer{}
-	arc, err := newResourceExplorer(&config.resourceExplorerConfig, e.listPods, e.explorePod)
+	arc, err := newResourceExplorer(&config.resourceExplorerConfig, podResource, e.explorePod)
 
 	if err != nil {
 		return nil, err
 	}
 
 	e.resourceExplorer = arc
-	e.namespace = config.Namespace
+	if e.expressions, err = config.expressions(); err != nil {
+		return nil, err
+	}
+	e.namespaces = config.namespaces()
+	e.namespaceSelector = config.NamespaceSelector
 	e.podPort = config.PodPort
+	e.podPortName = config.PodPortName
+	e.requireReady = config.RequireReady
+	e.readinessGate = corev1.PodConditionType(config.ReadinessGate)
+	e.excludeTerminating = config.ExcludeTerminating
 	return e, nil
 }
 
-func (e *podExplorer) listPods(ctx context.Context) ([]any, error) {
-	list, err := e.k8sClient.CoreV1().Pods(e.namespace).List(ctx, e.newListOptions())
-	if err != nil {
-		return nil, err
+func (e *podExplorer) explorePod(ctx context.Context, resource any) *explorer.Discovery {
+	pod, ok := resource.(*corev1.Pod)
+	if !ok || !e.includePod(pod) {
+		return nil
 	}
 
-	var items []any
-	for idx := range list.Items {
-		items = append(items, &list.Items[idx])
+	port := e.podPort
+	if e.podPortName != "" {
+		if port, ok = containerPort(pod, e.podPortName); !ok {
+			log.Debugf("skipping pod %s/%s without container port '%s'", pod.Namespace, pod.Name, e.podPortName)
+			return nil
+		}
 	}
 
-	return items, nil
-}
+	podIPs := pod.Status.PodIPs
+	if len(podIPs) == 0 && pod.Status.PodIP != "" {
+		podIPs = []corev1.PodIP{{IP: pod.Status.PodIP}}
+	}
 
-func (e *podExplorer) explorePod(ctx context.Context, resource any) *explorer.Discovery {
-	pod, ok := resource.(*corev1.Pod)
-	if !ok {
+	var addresses []peer.Address
+	for _, podIP := range podIPs {
+		if ipAddr := net.ParseIP(podIP.IP); ipAddr != nil {
+			addresses = append(addresses, peer.NewAddress(ipAddr))
+		}
+	}
+
+	if len(addresses) == 0 {
 		return nil
 	}
 
-	if ipAddr := net.ParseIP(pod.Status.PodIP); ipAddr != nil {
-		dis := &explorer.Discovery{
-			Port: e.podPort,
-		}
+	dis := newObjectDiscovery("pod", pod)
+	dis.Addresses = addresses
+	dis.Port = port
+	if pod.Spec.NodeName != "" {
+		dis.Labels[labelNodeName] = pod.Spec.NodeName
+	}
 
-		if ipAddr.To4() != nil {
-			dis.IPv4Addr = ipAddr
-		} else {
-			dis.IPv6Addr = ipAddr
+	return dis
+}
+
+// includePod applies the filters on the state of the pod.
+func (e *podExplorer) includePod(pod *corev1.Pod) bool {
+	if e.excludeTerminating && pod.DeletionTimestamp != nil {
+		return false
+	}
+
+	if e.requireReady && (pod.Status.Phase != corev1.PodRunning || !podCondition(pod, corev1.PodReady)) {
+		return false
+	}
+
+	return e.readinessGate == "" || podCondition(pod, e.readinessGate)
+}
+
+func podCondition(pod *corev1.Pod, conditionType corev1.PodConditionType) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == conditionType {
+			return condition.Status == corev1.ConditionTrue
 		}
+	}
+
+	return false
+}
 
-		return dis
+func containerPort(pod *corev1.Pod, name string) (uint16, bool) {
+	for _, container := range pod.Spec.Containers {
+		for _, port := range container.Ports {
+			if port.Name == name {
+				return uint16(port.ContainerPort), true
+			}
+		}
 	}
 
-	return nil
+	return 0, false
 }
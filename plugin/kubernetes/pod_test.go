@@ -1,21 +1,163 @@
 package kubernetes
 
-import "testing"
+import (
+	"context"
+	"testing"
+
+	"github.com/ravenix/peerd/internal/peer"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
 
 func TestNewPodExplorerSetsNamespace(t *testing.T) {
 	e, err := newpodExplorer(&podExplorerConfig{
 		resourceExplorerConfig: resourceExplorerConfig{
 			ApiServer: "https://127.0.0.1",
 		},
-		Namespace: "router-system",
-		PodPort:   179,
+		namespaceConfig: namespaceConfig{
+			Namespace:  "router-system",
+			Namespaces: []string{"edge-a", "router-system"},
+		},
+		PodPort: 179,
 	})
 	if err != nil {
 		t.Fatalf("unexpected error creating pod explorer: %v", err)
 	}
 
-	if e.namespace != "router-system" {
-		t.Fatalf("unexpected namespace: %q", e.namespace)
+	if len(e.namespaces) != 2 || e.namespaces[0] != "router-system" || e.namespaces[1] != "edge-a" {
+		t.Fatalf("unexpected namespaces: %q", e.namespaces)
 	}
 }
 
+func TestExplorePodSetsIdentityAndLabels(t *testing.T) {
+	e, err := newpodExplorer(&podExplorerConfig{
+		resourceExplorerConfig: resourceExplorerConfig{
+			ApiServer: "https://127.0.0.1",
+		},
+		PodPort: 179,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating pod explorer: %v", err)
+	}
+
+	dis := e.explorePod(context.Background(), &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "router-0",
+			Namespace: "router-system",
+			Labels:    map[string]string{"app": "router"},
+		},
+		Spec:   corev1.PodSpec{NodeName: "node-a"},
+		Status: corev1.PodStatus{PodIP: "10.0.0.1"},
+	})
+	if dis == nil {
+		t.Fatalf("expected discovery")
+	}
+
+	if dis.ID != "pod/router-system/router-0" || dis.Name != "router-0" {
+		t.Fatalf("unexpected identity: id=%q name=%q", dis.ID, dis.Name)
+	}
+
+	if dis.Labels["app"] != "router" || dis.Labels[labelNamespace] != "router-system" || dis.Labels[labelNodeName] != "node-a" {
+		t.Fatalf("unexpected labels: %v", dis.Labels)
+	}
+}
+
+func TestExplorePodReportsAllPodIPs(t *testing.T) {
+	e, err := newpodExplorer(&podExplorerConfig{
+		resourceExplorerConfig: resourceExplorerConfig{
+			ApiServer: "https://127.0.0.1",
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating pod explorer: %v", err)
+	}
+
+	dis := e.explorePod(context.Background(), &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "router-0", Namespace: "router-system"},
+		Status: corev1.PodStatus{
+			PodIP:  "10.0.0.1",
+			PodIPs: []corev1.PodIP{{IP: "10.0.0.1"}, {IP: "fd00::1"}},
+		},
+	})
+	if dis == nil {
+		t.Fatalf("expected discovery")
+	}
+
+	if len(dis.Addresses) != 2 || dis.Addresses[0].Family != peer.FamilyIPv4 || dis.Addresses[1].Family != peer.FamilyIPv6 {
+		t.Fatalf("unexpected addresses: %v", dis.Addresses)
+	}
+}
+
+func TestExplorePodAppliesFilters(t *testing.T) {
+	running := corev1.PodStatus{
+		Phase:      corev1.PodRunning,
+		PodIP:      "10.0.0.1",
+		Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+	}
+	notReady := corev1.PodStatus{
+		Phase:      corev1.PodRunning,
+		PodIP:      "10.0.0.1",
+		Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionFalse}},
+	}
+	gated := corev1.PodStatus{
+		Phase:      corev1.PodRunning,
+		PodIP:      "10.0.0.1",
+		Conditions: []corev1.PodCondition{{Type: "example.com/peering", Status: corev1.ConditionTrue}},
+	}
+	now := metav1.Now()
+
+	for name, tc := range map[string]struct {
+		config   podExplorerConfig
+		meta     metav1.ObjectMeta
+		status   corev1.PodStatus
+		expected bool
+	}{
+		"ready pod":         {config: podExplorerConfig{RequireReady: true}, status: running, expected: true},
+		"not ready pod":     {config: podExplorerConfig{RequireReady: true}, status: notReady},
+		"pending pod":       {config: podExplorerConfig{RequireReady: true}, status: corev1.PodStatus{Phase: corev1.PodPending, PodIP: "10.0.0.1"}},
+		"readiness gate":    {config: podExplorerConfig{ReadinessGate: "example.com/peering"}, status: gated, expected: true},
+		"missing gate":      {config: podExplorerConfig{ReadinessGate: "example.com/peering"}, status: running},
+		"terminating pod":   {config: podExplorerConfig{ExcludeTerminating: true}, meta: metav1.ObjectMeta{DeletionTimestamp: &now}, status: running},
+		"terminating kept":  {meta: metav1.ObjectMeta{DeletionTimestamp: &now}, status: running, expected: true},
+		"unfiltered pod":    {status: notReady, expected: true},
+		"named port absent": {config: podExplorerConfig{PodPortName: "bgp"}, status: running},
+	} {
+		tc.config.ApiServer = "https://127.0.0.1"
+		e, err := newpodExplorer(&tc.config)
+		if err != nil {
+			t.Fatalf("%s: unexpected error creating pod explorer: %v", name, err)
+		}
+
+		tc.meta.Name, tc.meta.Namespace = "router-0", "router-system"
+		dis := e.explorePod(context.Background(), &corev1.Pod{ObjectMeta: tc.meta, Status: tc.status})
+		if (dis != nil) != tc.expected {
+			t.Errorf("%s: expected discovery %t, got %+v", name, tc.expected, dis)
+		}
+	}
+}
+
+func TestExplorePodResolvesNamedPort(t *testing.T) {
+	e, err := newpodExplorer(&podExplorerConfig{
+		resourceExplorerConfig: resourceExplorerConfig{
+			ApiServer: "https://127.0.0.1",
+		},
+		PodPortName: "bgp",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating pod explorer: %v", err)
+	}
+
+	dis := e.explorePod(context.Background(), &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "router-0", Namespace: "router-system"},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{Name: "metrics", Ports: []corev1.ContainerPort{{Name: "metrics", ContainerPort: 9090}}},
+				{Name: "router", Ports: []corev1.ContainerPort{{Name: "bgp", ContainerPort: 1179}}},
+			},
+		},
+		Status: corev1.PodStatus{PodIP: "10.0.0.1"},
+	})
+	if dis == nil || dis.Port != 1179 {
+		t.Fatalf("expected port of the named container port, got %+v", dis)
+	}
+}
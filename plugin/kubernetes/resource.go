@@ -2,40 +2,180 @@ package kubernetes
 
 import (
 	"context"
-	"time"
+	"fmt"
+	"reflect"
+	"sync"
 
 	"github.com/ravenix/peerd/pkg/explorer"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	labelNamespace = "kubernetes.namespace"
+	labelNodeName  = "kubernetes.node_name"
 )
 
 type resourceExplorer struct {
 	explorer.Explorer
 
-	k8sClient     *kubernetes.Clientset
+	k8sClient     kubernetes.Interface
+	connection    string
 	labelSelector string
 	fieldSelector string
 
-	listResources   func(context.Context) ([]any, error)
+	namespaces        []string
+	namespaceSelector string
+
+	resource        resourceType
 	exploreResource func(context.Context, any) *explorer.Discovery
+	expressions     *expressions
+
+	skipMu sync.Mutex
+	skip   map[string]string
+
+	// exploreAll, if set, replaces exploreResource for objects which only
+	// yield peers together, and is called with all objects of a namespace.
+	exploreAll func(context.Context, []any) []*explorer.Discovery
 }
 
+// resourceType tells how to list and watch one kind of object.
+type resourceType struct {
+	name   string
+	object runtime.Object
+	list   func(context.Context, kubernetes.Interface, string, metav1.ListOptions) (runtime.Object, error)
+	watch  func(context.Context, kubernetes.Interface, string, metav1.ListOptions) (watch.Interface, error)
+}
+
+// resourceExplorerConfig connects to the API server given by api_server, by the
+// kubeconfig or, if neither is set, from within the cluster. The server and
+// the files given for credentials override those of the kubeconfig.
 type resourceExplorerConfig struct {
-	ApiServer     string `yaml:"api_server"`
-	CAFile        string `yaml:"ca_file"`
-	TokenFile     string `yaml:"token_file"`
-	LabelSelector string `yaml:"label_selector"`
-	FieldSelector string `yaml:"field_selector"`
-}
-
-func newResourceExplorer(config *resourceExplorerConfig, listResources func(context.Context) ([]any, error), exploreResource func(context.Context, any) *explorer.Discovery) (*resourceExplorer, error) {
-	k8sConfig := &rest.Config{
-		Host:            config.ApiServer,
-		BearerTokenFile: config.TokenFile,
-		TLSClientConfig: rest.TLSClientConfig{
-			CAFile: config.CAFile,
-		},
+	InCluster      bool    `yaml:"in_cluster"`
+	Kubeconfig     string  `yaml:"kubeconfig"`
+	Context        string  `yaml:"context"`
+	ApiServer      string  `yaml:"api_server"`
+	CAFile         string  `yaml:"ca_file"`
+	TokenFile      string  `yaml:"token_file"`
+	ClientCertFile string  `yaml:"client_cert_file"`
+	ClientKeyFile  string  `yaml:"client_key_file"`
+	QPS            float32 `yaml:"qps"`
+	Burst          int     `yaml:"burst"`
+	UserAgent      string  `yaml:"user_agent"`
+	LabelSelector  string  `yaml:"label_selector"`
+	FieldSelector  string  `yaml:"field_selector"`
+}
+
+func (c *resourceExplorerConfig) validate() error {
+	if c.InCluster && (c.Kubeconfig != "" || c.ApiServer != "") {
+		return fmt.Errorf("in_cluster cannot be combined with kubeconfig or api_server")
+	}
+
+	if c.Context != "" && c.Kubeconfig == "" {
+		return fmt.Errorf("context requires kubeconfig")
+	}
+
+	if c.ApiServer == "" && c.Kubeconfig == "" && (c.CAFile != "" || c.TokenFile != "" || c.ClientCertFile != "" || c.ClientKeyFile != "") {
+		return fmt.Errorf("ca_file, token_file and client certificates require api_server or kubeconfig")
+	}
+
+	if (c.ClientCertFile == "") != (c.ClientKeyFile == "") {
+		return fmt.Errorf("client_cert_file and client_key_file must be set together")
+	}
+
+	if c.QPS < 0 || c.Burst < 0 {
+		return fmt.Errorf("qps and burst must not be negative")
+	}
+
+	if _, err := labels.Parse(c.LabelSelector); err != nil {
+		return fmt.Errorf("invalid label_selector: %w", err)
+	}
+
+	if _, err := fields.ParseSelector(c.FieldSelector); err != nil {
+		return fmt.Errorf("invalid field_selector: %w", err)
+	}
+
+	return nil
+}
+
+// connection identifies the API server and the credentials used for it.
+func (c *resourceExplorerConfig) connection() string {
+	return fmt.Sprintf(
+		"%t\x00%s\x00%s\x00%s\x00%s\x00%s\x00%s\x00%s\x00%g\x00%d\x00%s",
+		c.InCluster, c.Kubeconfig, c.Context, c.ApiServer, c.CAFile, c.TokenFile,
+		c.ClientCertFile, c.ClientKeyFile, c.QPS, c.Burst, c.UserAgent,
+	)
+}
+
+func (c *resourceExplorerConfig) restConfig() (*rest.Config, error) {
+	var k8sConfig *rest.Config
+	switch {
+	case c.Kubeconfig != "":
+		overrides := &clientcmd.ConfigOverrides{CurrentContext: c.Context}
+		overrides.ClusterInfo.Server = c.ApiServer
+		overrides.ClusterInfo.CertificateAuthority = c.CAFile
+		overrides.AuthInfo.TokenFile = c.TokenFile
+		overrides.AuthInfo.ClientCertificate = c.ClientCertFile
+		overrides.AuthInfo.ClientKey = c.ClientKeyFile
+
+		var err error
+		k8sConfig, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			&clientcmd.ClientConfigLoadingRules{ExplicitPath: c.Kubeconfig},
+			overrides,
+		).ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("could not load kubeconfig: %w", err)
+		}
+	case c.ApiServer != "":
+		k8sConfig = &rest.Config{
+			Host:            c.ApiServer,
+			BearerTokenFile: c.TokenFile,
+			TLSClientConfig: rest.TLSClientConfig{
+				CAFile:   c.CAFile,
+				CertFile: c.ClientCertFile,
+				KeyFile:  c.ClientKeyFile,
+			},
+		}
+	default:
+		var err error
+		k8sConfig, err = rest.InClusterConfig()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if c.QPS > 0 {
+		k8sConfig.QPS = c.QPS
+	}
+
+	if c.Burst > 0 {
+		k8sConfig.Burst = c.Burst
+	}
+
+	if c.UserAgent != "" {
+		k8sConfig.UserAgent = c.UserAgent
+	}
+
+	return k8sConfig, nil
+}
+
+func newResourceExplorer(config *resourceExplorerConfig, resource resourceType, exploreResource func(context.Context, any) *explorer.Discovery) (*resourceExplorer, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	k8sConfig, err := config.restConfig()
+	if err != nil {
+		return nil, err
 	}
 
 	client, err := kubernetes.NewForConfig(k8sConfig)
@@ -46,41 +186,353 @@ func newResourceExplorer(config *resourceExplorerConfig, listResources func(cont
 
 	return &resourceExplorer{
 		k8sClient:     client,
+		connection:    config.connection(),
 		labelSelector: config.LabelSelector,
 		fieldSelector: config.FieldSelector,
 
-		listResources:   listResources,
+		resource:        resource,
 		exploreResource: exploreResource,
 	}, nil
 }
 
+// polledExplorer hides that an explorer can be streamed, so the group explores
+// it on its cadence instead.
+type polledExplorer struct {
+	explorer explorer.Explorer
+}
+
+func (e *polledExplorer) Run(ctx context.Context) error {
+	return e.explorer.Run(ctx)
+}
+
+func (e *polledExplorer) Explore(ctx context.Context, dh explorer.DiscoveryHandler) error {
+	return e.explorer.Explore(ctx, dh)
+}
+
 func (e *resourceExplorer) Run(ctx context.Context) error {
 	return nil
 }
 
-func (e *resourceExplorer) Cadence() explorer.Cadence {
-	return explorer.Cadence{
-		ExploreInterval: 2 * time.Second,
-		ExploreTimeout:  1500 * time.Millisecond,
-		PeerTTL:         6 * time.Second,
+// Stream reports the objects of the watched namespaces as the informers, which
+// are shared with other explorers of the same objects, see them change.
+// Objects which are deleted, or no longer yield a discovery, are removed right
+// away.
+func (e *resourceExplorer) Stream(ctx context.Context, events explorer.EventHandler) error {
+	if e.namespaceSelector != "" {
+		return e.streamSelectedNamespaces(ctx, events)
 	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(e.watchedNamespaces()))
+	for _, namespace := range e.watchedNamespaces() {
+		wg.Add(1)
+		go func(namespace string) {
+			defer wg.Done()
+			if err := e.streamNamespace(ctx, ctx.Done(), namespace, events); err != nil {
+				errs <- err
+			}
+		}(namespace)
+	}
+
+	wg.Wait()
+	close(errs)
+	return <-errs
 }
 
-func (e *resourceExplorer) Explore(ctx context.Context, dh explorer.DiscoveryHandler) error {
-	resources, err := e.listResources(ctx)
+// streamNamespace reports the objects of one namespace until stop is closed.
+// When that happens while the explorer keeps running, the namespace is no
+// longer watched and its objects are removed.
+func (e *resourceExplorer) streamNamespace(ctx context.Context, stop <-chan struct{}, namespace string, events explorer.EventHandler) error {
+	shared := e.acquireInformer(e.resource, namespace, e.labelSelector, e.fieldSelector)
+	defer releaseInformer(shared)
+
+	var mu sync.Mutex
+	stopped := false
+	report := func(report func()) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if !stopped {
+			report()
+		}
+	}
+
+	var handler cache.ResourceEventHandler
+	var remaining func() []*explorer.Discovery
+	if e.exploreAll != nil {
+		reported := make(map[string]*explorer.Discovery)
+		refresh := func(any) {
+			report(func() { e.reportAll(ctx, shared.informer.GetStore().List(), reported, events) })
+		}
+
+		handler = cache.ResourceEventHandlerFuncs{
+			AddFunc:    refresh,
+			UpdateFunc: func(_ any, obj any) { refresh(obj) },
+			DeleteFunc: refresh,
+		}
+		remaining = func() []*explorer.Discovery {
+			var discoveries []*explorer.Discovery
+			for _, dis := range reported {
+				discoveries = append(discoveries, dis)
+			}
+			return discoveries
+		}
+	} else {
+		handler, remaining = e.objectHandler(ctx, report, events)
+	}
+
+	registration, err := shared.informer.AddEventHandler(handler)
 	if err != nil {
 		return err
 	}
 
-	for _, resource := range resources {
-		if dis := e.exploreResource(ctx, resource); dis != nil {
-			dh.Discovered(dis)
+	<-stop
+	_ = shared.informer.RemoveEventHandler(registration)
+
+	mu.Lock()
+	stopped = true
+	mu.Unlock()
+
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	for _, dis := range remaining() {
+		events.Removed(dis)
+	}
+
+	return nil
+}
+
+// objectHandler reports every object on its own. What was reported for an
+// object is kept, so only the new state of an object is explored.
+func (e *resourceExplorer) objectHandler(ctx context.Context, report func(func()), events explorer.EventHandler) (cache.ResourceEventHandler, func() []*explorer.Discovery) {
+	reported := make(map[string]*explorer.Discovery)
+	changed := func(obj any) {
+		key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+		if err != nil {
+			return
+		}
+
+		current := e.explore(ctx, obj)
+		report(func() {
+			previous, ok := reported[key]
+			switch {
+			case current == nil && ok:
+				delete(reported, key)
+				events.Removed(previous)
+			case current != nil && !ok:
+				reported[key] = current
+				events.Added(current)
+			case current != nil && !reflect.DeepEqual(previous, current):
+				reported[key] = current
+				events.Updated(current)
+			}
+		})
+	}
+
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    changed,
+		UpdateFunc: func(_ any, newObj any) { changed(newObj) },
+		DeleteFunc: func(obj any) {
+			key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+			if err != nil {
+				return
+			}
+
+			e.forgetSkipped(key)
+			report(func() {
+				if previous, ok := reported[key]; ok {
+					delete(reported, key)
+					events.Removed(previous)
+				}
+			})
+		},
+	}
+
+	remaining := func() []*explorer.Discovery {
+		var discoveries []*explorer.Discovery
+		for _, dis := range reported {
+			discoveries = append(discoveries, dis)
+		}
+		return discoveries
+	}
+
+	return handler, remaining
+}
+
+// reportAll explores all objects at once and reports how the result differs
+// from what was reported before.
+func (e *resourceExplorer) reportAll(ctx context.Context, objs []any, reported map[string]*explorer.Discovery, events explorer.EventHandler) {
+	current := make(map[string]*explorer.Discovery)
+	for _, dis := range e.exploreAll(ctx, objs) {
+		current[dis.ID] = dis
+	}
+
+	for id, dis := range current {
+		previous, ok := reported[id]
+		switch {
+		case !ok:
+			events.Added(dis)
+		case !reflect.DeepEqual(previous, dis):
+			events.Updated(dis)
+		}
+	}
+
+	for id, dis := range reported {
+		if _, ok := current[id]; !ok {
+			events.Removed(dis)
+			delete(reported, id)
+		}
+	}
+
+	for id, dis := range current {
+		reported[id] = dis
+	}
+}
+
+// Explore lists the objects once. It is only used when the explorer is not
+// streamed.
+func (e *resourceExplorer) Explore(ctx context.Context, dh explorer.DiscoveryHandler) error {
+	namespaces := e.watchedNamespaces()
+	if e.namespaceSelector != "" {
+		selected, err := e.listSelectedNamespaces(ctx)
+		if err != nil {
+			return err
+		}
+		namespaces = append(namespaces, selected...)
+	}
+
+	for _, namespace := range namespaces {
+		list, err := e.resource.list(ctx, e.k8sClient, namespace, e.newListOptions())
+		if err != nil {
+			return err
+		}
+
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return err
+		}
+
+		if e.exploreAll != nil {
+			objs := make([]any, 0, len(items))
+			for _, item := range items {
+				objs = append(objs, item)
+			}
+
+			for _, dis := range e.exploreAll(ctx, objs) {
+				dh.Discovered(dis)
+			}
+			continue
+		}
+
+		for _, item := range items {
+			if dis := e.explore(ctx, item); dis != nil {
+				dh.Discovered(dis)
+			}
 		}
 	}
 
 	return nil
 }
 
+func (e *resourceExplorer) informerKey(namespace string) informerKey {
+	return informerKey{
+		connection:    e.connection,
+		resource:      e.resource.name,
+		namespace:     namespace,
+		labelSelector: e.labelSelector,
+		fieldSelector: e.fieldSelector,
+	}
+}
+
+// acquireInformer returns the shared informer for the objects, which need not
+// be those the explorer reports.
+func (e *resourceExplorer) acquireInformer(resource resourceType, namespace string, labelSelector string, fieldSelector string) *sharedInformer {
+	key := informerKey{
+		connection:    e.connection,
+		resource:      resource.name,
+		namespace:     namespace,
+		labelSelector: labelSelector,
+		fieldSelector: fieldSelector,
+	}
+
+	return acquireInformer(key, func() cache.ListerWatcher {
+		return &cache.ListWatch{
+			ListWithContextFunc: func(ctx context.Context, options metav1.ListOptions) (runtime.Object, error) {
+				options.LabelSelector, options.FieldSelector = labelSelector, fieldSelector
+				return resource.list(ctx, e.k8sClient, namespace, options)
+			},
+			WatchFuncWithContext: func(ctx context.Context, options metav1.ListOptions) (watch.Interface, error) {
+				options.LabelSelector, options.FieldSelector = labelSelector, fieldSelector
+				return resource.watch(ctx, e.k8sClient, namespace, options)
+			},
+		}
+	}, resource.object)
+}
+
+func newObjectDiscovery(kind string, obj metav1.Object) *explorer.Discovery {
+	labels := make(map[string]string, len(obj.GetLabels())+1)
+	for k, v := range obj.GetLabels() {
+		labels[k] = v
+	}
+
+	id := kind + "/" + obj.GetName()
+	if namespace := obj.GetNamespace(); namespace != "" {
+		labels[labelNamespace] = namespace
+		id = kind + "/" + namespace + "/" + obj.GetName()
+	}
+
+	return &explorer.Discovery{
+		ID:     id,
+		Name:   obj.GetName(),
+		Labels: labels,
+	}
+}
+
+// explore turns an object into a discovery, with the expressions of the
+// explorer applied.
+func (e *resourceExplorer) explore(ctx context.Context, obj any) *explorer.Discovery {
+	dis := e.exploreResource(ctx, obj)
+	if dis == nil || e.expressions == nil {
+		return dis
+	}
+
+	key, _ := cache.MetaNamespaceKeyFunc(obj)
+	if err := e.expressions.apply(obj, dis); err != nil {
+		e.skipped(key, dis.ID, err)
+		return nil
+	}
+
+	e.forgetSkipped(key)
+	return dis
+}
+
+// skipped logs why an object is skipped. Objects are explored on every change
+// and every cycle, so only a new reason is logged as a warning.
+func (e *resourceExplorer) skipped(key string, id string, err error) {
+	e.skipMu.Lock()
+	defer e.skipMu.Unlock()
+
+	if e.skip[key] == err.Error() {
+		log.Debugf("Skipping kubernetes %s: %v", id, err)
+		return
+	}
+
+	if e.skip == nil {
+		e.skip = make(map[string]string)
+	}
+	e.skip[key] = err.Error()
+	log.Warnf("Skipping kubernetes %s: %v", id, err)
+}
+
+func (e *resourceExplorer) forgetSkipped(key string) {
+	e.skipMu.Lock()
+	defer e.skipMu.Unlock()
+
+	delete(e.skip, key)
+}
+
 func (e *resourceExplorer) newListOptions() metav1.ListOptions {
 	return metav1.ListOptions{
 		LabelSelector: e.labelSelector,
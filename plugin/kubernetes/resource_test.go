@@ -0,0 +1,265 @@
+package kubernetes
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ravenix/peerd/pkg/explorer"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+type testEvent struct {
+	kind      string
+	discovery *explorer.Discovery
+}
+
+type testEventHandler chan testEvent
+
+func (h testEventHandler) Added(d *explorer.Discovery)   { h <- testEvent{"added", d} }
+func (h testEventHandler) Updated(d *explorer.Discovery) { h <- testEvent{"updated", d} }
+func (h testEventHandler) Removed(d *explorer.Discovery) { h <- testEvent{"removed", d} }
+
+func (h testEventHandler) next(t *testing.T) testEvent {
+	t.Helper()
+
+	select {
+	case ev := <-h:
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for event")
+		return testEvent{}
+	}
+}
+
+func newTestNode(name string, address string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: corev1.NodeStatus{
+			Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: address}},
+		},
+	}
+}
+
+// newFakeClientset returns a fake clientset holding the objects, and a channel
+// closed once the resource is first watched.
+func newFakeClientset(resource string, objects ...runtime.Object) (*fake.Clientset, chan struct{}) {
+	client := fake.NewClientset(objects...)
+	watching := make(chan struct{})
+	client.PrependWatchReactor(resource, func(action k8stesting.Action) (bool, watch.Interface, error) {
+		select {
+		case <-watching:
+		default:
+			close(watching)
+		}
+		return false, nil, nil
+	})
+
+	return client, watching
+}
+
+// newFakeNodeExplorer returns a node explorer on a fake clientset, and a
+// channel closed once the informer started watching.
+func newFakeNodeExplorer(t *testing.T, objects ...runtime.Object) (*nodeExplorer, *fake.Clientset, chan struct{}) {
+	e, err := newNodeExplorer(&nodeExplorerConfig{
+		resourceExplorerConfig: resourceExplorerConfig{
+			ApiServer: "https://" + t.Name(),
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating node explorer: %v", err)
+	}
+
+	client, watching := newFakeClientset("nodes", objects...)
+	e.k8sClient = client
+	return e, client, watching
+}
+
+func TestStreamReportsChangesOfNodes(t *testing.T) {
+	e, client, watching := newFakeNodeExplorer(t, newTestNode("node-a", "10.0.0.1"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := make(testEventHandler, 10)
+	go func() { _ = e.Stream(ctx, events) }()
+
+	if ev := events.next(t); ev.kind != "added" || ev.discovery.ID != "node/node-a" {
+		t.Fatalf("unexpected event: %+v", ev)
+	}
+	<-watching
+
+	nodes := client.CoreV1().Nodes()
+	if _, err := nodes.Update(ctx, newTestNode("node-a", "10.0.0.2"), metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if ev := events.next(t); ev.kind != "updated" || ev.discovery.Addresses[0].IP.String() != "10.0.0.2" {
+		t.Fatalf("unexpected event: %+v", ev)
+	}
+
+	if err := nodes.Delete(ctx, "node-a", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if ev := events.next(t); ev.kind != "removed" || ev.discovery.ID != "node/node-a" {
+		t.Fatalf("unexpected event: %+v", ev)
+	}
+}
+
+func TestStreamSharesInformers(t *testing.T) {
+	e, _, _ := newFakeNodeExplorer(t, newTestNode("node-a", "10.0.0.1"))
+	other := &resourceExplorer{
+		k8sClient:       e.k8sClient,
+		connection:      e.connection,
+		resource:        e.resource,
+		exploreResource: e.exploreResource,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first, second := make(testEventHandler, 10), make(testEventHandler, 10)
+	done := make(chan struct{}, 2)
+	go func() { _ = e.Stream(ctx, first); done <- struct{}{} }()
+	go func() { _ = other.Stream(ctx, second); done <- struct{}{} }()
+
+	first.next(t)
+	second.next(t)
+
+	informersMu.Lock()
+	shared := informers[e.informerKey("")]
+	informersMu.Unlock()
+	if shared == nil || shared.users != 2 {
+		t.Fatalf("expected both explorers to use one informer, got %+v", shared)
+	}
+
+	cancel()
+	<-done
+	<-done
+
+	informersMu.Lock()
+	defer informersMu.Unlock()
+	if _, ok := informers[e.informerKey("")]; ok {
+		t.Fatal("expected informer to be stopped once released")
+	}
+}
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: a
+  cluster:
+    server: https://a.example:6443
+- name: b
+  cluster:
+    server: https://b.example:6443
+users:
+- name: peerd
+  user:
+    token: secret
+contexts:
+- name: a
+  context:
+    cluster: a
+    user: peerd
+- name: b
+  context:
+    cluster: b
+    user: peerd
+current-context: a
+`
+
+func TestRestConfigFromKubeconfigContext(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := os.WriteFile(path, []byte(testKubeconfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &resourceExplorerConfig{
+		Kubeconfig: path,
+		Context:    "b",
+		QPS:        50,
+		Burst:      100,
+		UserAgent:  "peerd-test",
+	}
+	if err := config.validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+
+	k8sConfig, err := config.restConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if k8sConfig.Host != "https://b.example:6443" || k8sConfig.BearerToken != "secret" {
+		t.Fatalf("expected context b to be used, got host %q", k8sConfig.Host)
+	}
+
+	if k8sConfig.QPS != 50 || k8sConfig.Burst != 100 || k8sConfig.UserAgent != "peerd-test" {
+		t.Fatalf("unexpected client settings: qps=%v burst=%d user_agent=%q", k8sConfig.QPS, k8sConfig.Burst, k8sConfig.UserAgent)
+	}
+}
+
+func TestRestConfigFromKubeconfigWithOverrides(t *testing.T) {
+	dir := t.TempDir()
+	for name, contents := range map[string]string{
+		"kubeconfig": testKubeconfig,
+		"ca.crt":     "",
+		"token":      "other",
+		"tls.crt":    "",
+		"tls.key":    "",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config := &resourceExplorerConfig{
+		Kubeconfig:     filepath.Join(dir, "kubeconfig"),
+		ApiServer:      "https://c.example:6443",
+		CAFile:         filepath.Join(dir, "ca.crt"),
+		TokenFile:      filepath.Join(dir, "token"),
+		ClientCertFile: filepath.Join(dir, "tls.crt"),
+		ClientKeyFile:  filepath.Join(dir, "tls.key"),
+	}
+	if err := config.validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+
+	k8sConfig, err := config.restConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if k8sConfig.Host != "https://c.example:6443" || k8sConfig.BearerTokenFile != config.TokenFile {
+		t.Fatalf("expected server and token to be overridden, got host %q, token file %q", k8sConfig.Host, k8sConfig.BearerTokenFile)
+	}
+
+	if tls := k8sConfig.TLSClientConfig; tls.CAFile != config.CAFile || tls.CertFile != config.ClientCertFile || tls.KeyFile != config.ClientKeyFile {
+		t.Fatalf("expected TLS files to be overridden, got %+v", tls)
+	}
+}
+
+func TestResourceExplorerConfigValidate(t *testing.T) {
+	for name, config := range map[string]resourceExplorerConfig{
+		"in cluster with api server": {InCluster: true, ApiServer: "https://127.0.0.1"},
+		"context without kubeconfig": {Context: "a"},
+		"token without api server":   {TokenFile: "token"},
+		"certificate without key":    {ApiServer: "https://127.0.0.1", ClientCertFile: "tls.crt"},
+		"negative qps":               {QPS: -1},
+	} {
+		if err := config.validate(); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+
+	if err := (&resourceExplorerConfig{}).validate(); err != nil {
+		t.Fatalf("expected empty configuration to default to in-cluster, got %v", err)
+	}
+}
@@ -0,0 +1,222 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/ravenix/peerd/internal/peer"
+	"github.com/ravenix/peerd/pkg/explorer"
+	"github.com/ravenix/peerd/pkg/plugin"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	addressLoadBalancer = "LoadBalancer"
+	addressExternal     = "ExternalIP"
+	addressCluster      = "ClusterIP"
+)
+
+// serviceExplorer reports the addresses services are reachable at from
+// outside the cluster: their load balancer ingress and, optionally, their
+// external and cluster IPs. Load balancers only known by hostname are
+// resolved when resolve_hostnames is set; the services are then listed on the
+// cadence of the group instead of being streamed, so lookups never block the
+// shared informers and follow changing addresses.
+type serviceExplorer struct {
+	*resourceExplorer
+	portName           string
+	includeExternalIPs bool
+	includeClusterIP   bool
+	resolveHostnames   bool
+}
+
+var serviceResource = resourceType{
+	name:   "services",
+	object: &corev1.Service{},
+	list: func(ctx context.Context, client kubernetes.Interface, namespace string, options metav1.ListOptions) (runtime.Object, error) {
+		return client.CoreV1().Services(namespace).List(ctx, options)
+	},
+	watch: func(ctx context.Context, client kubernetes.Interface, namespace string, options metav1.ListOptions) (watch.Interface, error) {
+		return client.CoreV1().Services(namespace).Watch(ctx, options)
+	},
+}
+
+type serviceExplorerConfig struct {
+	resourceExplorerConfig `yaml:",inline"`
+	namespaceConfig        `yaml:",inline"`
+	expressionConfig       `yaml:",inline"`
+	PortName               string `yaml:"port_name"`
+	IncludeExternalIPs     bool   `yaml:"include_external_ips"`
+	IncludeClusterIP       bool   `yaml:"include_cluster_ip"`
+	ResolveHostnames       bool   `yaml:"resolve_hostnames"`
+}
+
+func serviceExplorerInitializer(yamlConfig *yaml.Node) (explorer.Explorer, error) {
+	var config serviceExplorerConfig
+	if err := plugin.DecodeConfig(yamlConfig, &config); err != nil {
+		return nil, err
+	}
+
+	e, err := newServiceExplorer(&config)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.ResolveHostnames {
+		return &polledExplorer{explorer: e}, nil
+	}
+
+	return e, nil
+}
+
+func serviceExplorerValidator(yamlConfig *yaml.Node) error {
+	var config serviceExplorerConfig
+	if err := plugin.DecodeConfig(yamlConfig, &config); err != nil {
+		return err
+	}
+
+	return config.validate()
+}
+
+func (c *serviceExplorerConfig) validate() error {
+	if err := c.resourceExplorerConfig.validate(); err != nil {
+		return err
+	}
+
+	if err := c.namespaceConfig.validate(); err != nil {
+		return err
+	}
+
+	if err := c.expressionConfig.validate(); err != nil {
+		return err
+	}
+
+	if c.PortExpression != "" && c.PortName != "" {
+		return fmt.Errorf("port_expression and port_name cannot be set together")
+	}
+
+	return nil
+}
+
+func newServiceExplorer(config *serviceExplorerConfig) (*serviceExplorer, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	e := &serviceExplorer{}
+	arc, err := newResourceExplorer(&config.resourceExplorerConfig, serviceResource, e.exploreService)
+
+	if err != nil {
+		return nil, err
+	}
+
+	e.resourceExplorer = arc
+	if e.expressions, err = config.expressions(); err != nil {
+		return nil, err
+	}
+	e.namespaces = config.namespaces()
+	e.namespaceSelector = config.NamespaceSelector
+	e.portName = config.PortName
+	e.includeExternalIPs = config.IncludeExternalIPs
+	e.includeClusterIP = config.IncludeClusterIP
+	e.resolveHostnames = config.ResolveHostnames
+	return e, nil
+}
+
+func (e *serviceExplorer) exploreService(ctx context.Context, resource any) *explorer.Discovery {
+	service, ok := resource.(*corev1.Service)
+	if !ok {
+		return nil
+	}
+
+	port, ok := e.servicePort(service)
+	if !ok {
+		log.Debugf("skipping service %s/%s without port '%s'", service.Namespace, service.Name, e.portName)
+		return nil
+	}
+
+	var addresses []peer.Address
+	add := func(value string, label string) {
+		if ipAddr := net.ParseIP(value); ipAddr != nil {
+			address := peer.NewAddress(ipAddr)
+			address.Label = label
+			addresses = append(addresses, address)
+		}
+	}
+
+	for _, ingress := range service.Status.LoadBalancer.Ingress {
+		addresses = append(addresses, loadBalancerAddresses(ctx, "service", service, ingress.IP, ingress.Hostname, e.resolveHostnames)...)
+	}
+
+	if e.includeExternalIPs {
+		for _, externalIP := range service.Spec.ExternalIPs {
+			add(externalIP, addressExternal)
+		}
+	}
+
+	if e.includeClusterIP {
+		clusterIPs := service.Spec.ClusterIPs
+		if len(clusterIPs) == 0 && service.Spec.ClusterIP != "" {
+			clusterIPs = []string{service.Spec.ClusterIP}
+		}
+
+		for _, clusterIP := range clusterIPs {
+			add(clusterIP, addressCluster)
+		}
+	}
+
+	if len(addresses) == 0 {
+		return nil
+	}
+
+	dis := newObjectDiscovery("service", service)
+	dis.Addresses = addresses
+	dis.Port = port
+	return dis
+}
+
+// loadBalancerAddresses returns the addresses of one load balancer ingress of
+// the object. A hostname is only resolved with resolve set, which explorers
+// only do when they are polled.
+func loadBalancerAddresses(ctx context.Context, kind string, obj metav1.Object, ip string, hostname string, resolve bool) []peer.Address {
+	var ips []string
+	switch {
+	case ip != "":
+		ips = []string{ip}
+	case hostname != "" && resolve:
+		var err error
+		if ips, err = net.DefaultResolver.LookupHost(ctx, hostname); err != nil {
+			log.Debugf("could not resolve load balancer hostname %s of %s %s/%s: %v", hostname, kind, obj.GetNamespace(), obj.GetName(), err)
+		}
+	case hostname != "":
+		log.Debugf("ignoring load balancer hostname %s of %s %s/%s, resolve_hostnames is not set", hostname, kind, obj.GetNamespace(), obj.GetName())
+	}
+
+	var addresses []peer.Address
+	for _, value := range ips {
+		if ipAddr := net.ParseIP(value); ipAddr != nil {
+			address := peer.NewAddress(ipAddr)
+			address.Label = addressLoadBalancer
+			addresses = append(addresses, address)
+		}
+	}
+
+	return addresses
+}
+
+func (e *serviceExplorer) servicePort(service *corev1.Service) (uint16, bool) {
+	for _, port := range service.Spec.Ports {
+		if e.portName == "" || port.Name == e.portName {
+			return uint16(port.Port), true
+		}
+	}
+
+	return 0, e.portName == ""
+}
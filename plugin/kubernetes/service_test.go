@@ -0,0 +1,139 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ravenix/peerd/pkg/explorer"
+	"gopkg.in/yaml.v3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTestService() *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "router", Namespace: "router-system"},
+		Spec: corev1.ServiceSpec{
+			ClusterIP:   "10.96.0.10",
+			ClusterIPs:  []string{"10.96.0.10", "fd00:96::10"},
+			ExternalIPs: []string{"192.0.2.10"},
+			Ports: []corev1.ServicePort{
+				{Name: "metrics", Port: 9090},
+				{Name: "bgp", Port: 179},
+			},
+		},
+		Status: corev1.ServiceStatus{
+			LoadBalancer: corev1.LoadBalancerStatus{
+				Ingress: []corev1.LoadBalancerIngress{
+					{IP: "198.51.100.10"},
+					{Hostname: "router.example.com"},
+				},
+			},
+		},
+	}
+}
+
+func TestExploreServiceReportsLoadBalancerIngress(t *testing.T) {
+	e, err := newServiceExplorer(&serviceExplorerConfig{
+		resourceExplorerConfig: resourceExplorerConfig{
+			ApiServer: "https://127.0.0.1",
+		},
+		PortName: "bgp",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating service explorer: %v", err)
+	}
+
+	dis := e.exploreService(context.Background(), newTestService())
+	if dis == nil {
+		t.Fatalf("expected discovery")
+	}
+
+	if dis.ID != "service/router-system/router" || dis.Port != 179 {
+		t.Fatalf("unexpected discovery: %+v", dis)
+	}
+
+	if len(dis.Addresses) != 1 || dis.Addresses[0].IP.String() != "198.51.100.10" || dis.Addresses[0].Label != addressLoadBalancer {
+		t.Fatalf("expected only the load balancer address, got %v", dis.Addresses)
+	}
+}
+
+func TestExploreServiceIncludesExternalAndClusterIPs(t *testing.T) {
+	e, err := newServiceExplorer(&serviceExplorerConfig{
+		resourceExplorerConfig: resourceExplorerConfig{
+			ApiServer: "https://127.0.0.1",
+		},
+		IncludeExternalIPs: true,
+		IncludeClusterIP:   true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating service explorer: %v", err)
+	}
+
+	dis := e.exploreService(context.Background(), newTestService())
+	if dis == nil || len(dis.Addresses) != 4 || dis.Port != 9090 {
+		t.Fatalf("unexpected discovery: %+v", dis)
+	}
+
+	if dis.Addresses[1].Label != addressExternal || dis.Addresses[3].Label != addressCluster {
+		t.Fatalf("unexpected address labels: %v", dis.Addresses)
+	}
+}
+
+func TestExploreServiceSkipsMissingPort(t *testing.T) {
+	e, err := newServiceExplorer(&serviceExplorerConfig{
+		resourceExplorerConfig: resourceExplorerConfig{
+			ApiServer: "https://127.0.0.1",
+		},
+		PortName: "http",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating service explorer: %v", err)
+	}
+
+	if dis := e.exploreService(context.Background(), newTestService()); dis != nil {
+		t.Fatalf("expected service without the port to be skipped, got %+v", dis)
+	}
+}
+
+func TestExploreServiceResolvesLoadBalancerHostnames(t *testing.T) {
+	e, err := newServiceExplorer(&serviceExplorerConfig{
+		resourceExplorerConfig: resourceExplorerConfig{
+			ApiServer: "https://127.0.0.1",
+		},
+		ResolveHostnames: true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating service explorer: %v", err)
+	}
+
+	service := newTestService()
+	service.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{Hostname: "localhost"}}
+
+	dis := e.exploreService(context.Background(), service)
+	if dis == nil {
+		t.Fatalf("expected discovery")
+	}
+
+	for _, address := range dis.Addresses {
+		if !address.IP.IsLoopback() || address.Label != addressLoadBalancer {
+			t.Fatalf("expected the resolved load balancer addresses, got %v", dis.Addresses)
+		}
+	}
+}
+
+func TestServiceExplorerResolvingHostnamesIsPolled(t *testing.T) {
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte("api_server: https://127.0.0.1\nresolve_hostnames: true\n"), &node); err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := serviceExplorerInitializer(&node)
+	if err != nil {
+		t.Fatalf("unexpected error creating service explorer: %v", err)
+	}
+
+	if _, ok := e.(explorer.Streamer); ok {
+		t.Fatalf("expected service explorer resolving hostnames not to be streamed")
+	}
+}
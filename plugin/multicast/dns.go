@@ -5,16 +5,25 @@ import (
 	"fmt"
 	stdlibLog "log"
 	"net"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/hashicorp/mdns"
 	"github.com/ravenix/peerd/pkg/explorer"
+	"github.com/ravenix/peerd/pkg/plugin"
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v3"
 )
 
+const (
+	labelInstance = "multicast.instance"
+	// labelTXTPrefix prefixes the keys of the TXT record of a peer, so they
+	// cannot collide with the labels set by the explorer.
+	labelTXTPrefix = "multicast.txt."
+)
+
 type dnsExplorer struct {
 	instanceId    string
 	serviceDomain string
@@ -23,26 +32,64 @@ type dnsExplorer struct {
 }
 
 type dnsExplorerConfig struct {
-	InstanceId string   `yaml:"instance_id"`
-	Interface  string   `yaml:"interface"`
-	IPs        []net.IP `yaml:"ips"`
-	IPFilter   []string `yaml:"allowed_ips"`
-	Hostname   string   `yaml:"hostname"`
-	Domain     string   `yaml:"domain"`
-	Service    string   `yaml:"service"`
-	Port       uint16   `yaml:"port"`
+	InstanceId string            `yaml:"instance_id"`
+	Interface  string            `yaml:"interface"`
+	IPs        []net.IP          `yaml:"ips"`
+	IPFilter   []string          `yaml:"allowed_ips"`
+	Hostname   string            `yaml:"hostname"`
+	Domain     string            `yaml:"domain"`
+	Service    string            `yaml:"service"`
+	Port       uint16            `yaml:"port"`
+	TXT        map[string]string `yaml:"txt"`
 }
 
 func dnsExplorerInitializer(yamlConfig *yaml.Node) (explorer.Explorer, error) {
 	var config dnsExplorerConfig
-	if err := yamlConfig.Decode(&config); err != nil {
+	if err := plugin.DecodeConfig(yamlConfig, &config); err != nil {
 		return nil, err
 	}
 
 	return newDnsExplorer(&config)
 }
 
+func dnsExplorerValidator(yamlConfig *yaml.Node) error {
+	var config dnsExplorerConfig
+	if err := plugin.DecodeConfig(yamlConfig, &config); err != nil {
+		return err
+	}
+
+	return config.validate()
+}
+
+func (c *dnsExplorerConfig) validate() error {
+	if c.Interface == "" {
+		return fmt.Errorf("interface must be set")
+	}
+
+	if c.Service == "" {
+		return fmt.Errorf("service must be set")
+	}
+
+	for _, ipFilterStr := range c.IPFilter {
+		if _, _, err := net.ParseCIDR(ipFilterStr); err != nil {
+			return err
+		}
+	}
+
+	for k := range c.TXT {
+		if k == "" || strings.Contains(k, "=") {
+			return fmt.Errorf("invalid txt key '%s'", k)
+		}
+	}
+
+	return nil
+}
+
 func newDnsExplorer(config *dnsExplorerConfig) (*dnsExplorer, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
 	var ipFilters []net.IPNet
 	for _, ipFilterStr := range config.IPFilter {
 		_, ipFilter, err := net.ParseCIDR(ipFilterStr)
@@ -119,6 +166,12 @@ func newDnsExplorer(config *dnsExplorerConfig) (*dnsExplorer, error) {
 		instanceId = instanceUUID.String()
 	}
 
+	txt := make([]string, 0, len(config.TXT))
+	for k, v := range config.TXT {
+		txt = append(txt, k+"="+v)
+	}
+	sort.Strings(txt)
+
 	service, err := mdns.NewMDNSService(
 		instanceId,
 		config.Service,
@@ -126,7 +179,7 @@ func newDnsExplorer(config *dnsExplorerConfig) (*dnsExplorer, error) {
 		config.Hostname+".",
 		int(config.Port),
 		ifaceIPs,
-		[]string{},
+		txt,
 	)
 	if err != nil {
 		return nil, err
@@ -197,14 +250,32 @@ func (e *dnsExplorer) Explore(ctx context.Context, dh explorer.DiscoveryHandler)
 				continue
 			}
 
-			dh.Discovered(&explorer.Discovery{
-				IPv4Addr: entry.AddrV4,
-				IPv6Addr: entry.AddrV6,
-				Port:     uint16(entry.Port),
-			})
+			dh.Discovered(newEntryDiscovery(entry, e.serviceDomain))
 		}
 	}()
 
 	<-ctx.Done()
 	return nil
 }
+
+func newEntryDiscovery(entry *mdns.ServiceEntry, serviceDomain string) *explorer.Discovery {
+	instance := strings.TrimSuffix(entry.Name, "."+serviceDomain)
+
+	labels := map[string]string{}
+	for _, field := range entry.InfoFields {
+		k, v, _ := strings.Cut(field, "=")
+		if k != "" {
+			labels[labelTXTPrefix+k] = v
+		}
+	}
+	labels[labelInstance] = instance
+
+	return &explorer.Discovery{
+		ID:       instance,
+		Name:     strings.TrimSuffix(entry.Host, "."),
+		Labels:   labels,
+		IPv4Addr: entry.AddrV4,
+		IPv6Addr: entry.AddrV6,
+		Port:     uint16(entry.Port),
+	}
+}
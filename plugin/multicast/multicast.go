@@ -8,4 +8,5 @@ func init() {
 
 func setup(api plugin.PluginApi) {
 	api.RegisterExplorer("dns", dnsExplorerInitializer)
+	api.RegisterExplorerValidator("dns", dnsExplorerValidator)
 }
@@ -2,13 +2,20 @@ package netlink
 
 import (
 	"context"
+	"fmt"
 	"net"
 	"time"
 
 	"github.com/ravenix/peerd/pkg/explorer"
+	"github.com/ravenix/peerd/pkg/plugin"
 	"gopkg.in/yaml.v3"
 )
 
+const (
+	labelInterface    = "netlink.interface"
+	labelHardwareAddr = "netlink.hardware_addr"
+)
+
 type hardwareAddrExplorer struct {
 	iface string
 }
@@ -19,14 +26,35 @@ type hardwareAddrExplorerConfig struct {
 
 func hardwareAddrExplorerInitializer(yamlConfig *yaml.Node) (explorer.Explorer, error) {
 	var config hardwareAddrExplorerConfig
-	if err := yamlConfig.Decode(&config); err != nil {
+	if err := plugin.DecodeConfig(yamlConfig, &config); err != nil {
 		return nil, err
 	}
 
 	return newHardwareAddrExplorer(&config)
 }
 
+func hardwareAddrExplorerValidator(yamlConfig *yaml.Node) error {
+	var config hardwareAddrExplorerConfig
+	if err := plugin.DecodeConfig(yamlConfig, &config); err != nil {
+		return err
+	}
+
+	return config.validate()
+}
+
+func (c *hardwareAddrExplorerConfig) validate() error {
+	if c.Interface == "" {
+		return fmt.Errorf("interface must be set")
+	}
+
+	return nil
+}
+
 func newHardwareAddrExplorer(config *hardwareAddrExplorerConfig) (*hardwareAddrExplorer, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
 	return &hardwareAddrExplorer{
 		iface: config.Interface,
 	}, nil
@@ -58,6 +86,12 @@ func (e *hardwareAddrExplorer) Explore(ctx context.Context, dh explorer.Discover
 	copy(ipv6Addr[len(ipv6Addr)-len(hardwareAddr):], hardwareAddr[:])
 
 	dh.Discovered(&explorer.Discovery{
+		ID:   "hardwareaddr/" + e.iface,
+		Name: e.iface,
+		Labels: map[string]string{
+			labelInterface:    e.iface,
+			labelHardwareAddr: hardwareAddr.String(),
+		},
 		IPv4Addr: ipv4Addr,
 		IPv6Addr: ipv6Addr,
 	})
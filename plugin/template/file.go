@@ -9,14 +9,22 @@ import (
 
 	"github.com/ravenix/peerd/internal/peer"
 	"github.com/ravenix/peerd/pkg/handler"
+	"github.com/ravenix/peerd/pkg/plugin"
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v3"
 )
 
+const (
+	onShutdownKeep  = ""
+	onShutdownFinal = "final"
+	onShutdownEmpty = "empty"
+)
+
 type fileHandler struct {
 	tpl            *template.Template
 	outputFilename string
 	outputFilemode os.FileMode
+	onShutdown     string
 }
 
 type fileHandlerConfig struct {
@@ -24,28 +32,58 @@ type fileHandlerConfig struct {
 	Mode             os.FileMode `yaml:"mode"`
 	TemplateFilename string      `yaml:"template_filename"`
 	TemplateString   string      `yaml:"template_string"`
+	OnShutdown       string      `yaml:"on_shutdown"`
 }
 
 func fileHandlerInitializer(yamlConfig *yaml.Node) (handler.Handler, error) {
 	var config fileHandlerConfig
-	if err := yamlConfig.Decode(&config); err != nil {
+	if err := plugin.DecodeConfig(yamlConfig, &config); err != nil {
 		return nil, err
 	}
 
 	return newFileHandler(&config)
 }
 
-func newFileHandler(config *fileHandlerConfig) (*fileHandler, error) {
-	if config.Filename == "" {
-		return nil, fmt.Errorf("output filename must not be empty")
+func fileHandlerValidator(yamlConfig *yaml.Node) error {
+	var config fileHandlerConfig
+	if err := plugin.DecodeConfig(yamlConfig, &config); err != nil {
+		return err
+	}
+
+	return config.validate()
+}
+
+func (c *fileHandlerConfig) validate() error {
+	if c.Filename == "" {
+		return fmt.Errorf("output filename must not be empty")
+	}
+
+	if c.TemplateFilename == "" && c.TemplateString == "" {
+		return fmt.Errorf("template filename and template string cannot both be empty")
+	}
+
+	if c.TemplateFilename != "" && c.TemplateString != "" {
+		return fmt.Errorf("template filename and template string cannot both be set")
 	}
 
-	if config.TemplateFilename == "" && config.TemplateString == "" {
-		return nil, fmt.Errorf("template filename and template string cannot both be empty")
+	switch c.OnShutdown {
+	case onShutdownKeep, onShutdownFinal, onShutdownEmpty:
+	default:
+		return fmt.Errorf("on_shutdown must be one of '%s' or '%s'", onShutdownFinal, onShutdownEmpty)
 	}
 
-	if config.TemplateFilename != "" && config.TemplateString != "" {
-		return nil, fmt.Errorf("template filename and template string cannot both be set")
+	if c.TemplateString != "" {
+		if _, err := template.New("").Funcs(templateFuncs).Parse(c.TemplateString); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func newFileHandler(config *fileHandlerConfig) (*fileHandler, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
 	}
 
 	r := &fileHandler{}
@@ -63,13 +101,14 @@ func newFileHandler(config *fileHandlerConfig) (*fileHandler, error) {
 		tplContents = config.TemplateString
 	}
 
-	tpl, err := template.New(config.TemplateFilename).Parse(tplContents)
+	tpl, err := template.New(config.TemplateFilename).Funcs(templateFuncs).Parse(tplContents)
 	if err != nil {
 		return nil, err
 	}
 
 	r.outputFilename = config.Filename
 	r.outputFilemode = config.Mode
+	r.onShutdown = config.OnShutdown
 	r.tpl = tpl
 
 	return r, nil
@@ -91,6 +130,17 @@ func (r *fileHandler) PostExploration(ctx context.Context, peers []*peer.Peer, n
 	return r.writeTemplate(peers)
 }
 
+func (r *fileHandler) Shutdown(ctx context.Context, peers []*peer.Peer) error {
+	switch r.onShutdown {
+	case onShutdownFinal:
+		return r.writeTemplate(peers)
+	case onShutdownEmpty:
+		return r.writeTemplate(nil)
+	}
+
+	return nil
+}
+
 func (r *fileHandler) writeTemplate(peers []*peer.Peer) error {
 	var tplBuff bytes.Buffer
 	tplContext := &TemplateContext{Peers: peers}
@@ -1,6 +1,8 @@
 package template
 
 import (
+	"text/template"
+
 	"github.com/ravenix/peerd/internal/peer"
 	"github.com/ravenix/peerd/pkg/plugin"
 )
@@ -11,6 +13,13 @@ func init() {
 
 func setup(api plugin.PluginApi) {
 	api.RegisterHandler("file", fileHandlerInitializer)
+	api.RegisterHandlerValidator("file", fileHandlerValidator)
+}
+
+var templateFuncs = template.FuncMap{
+	"family": func(family string, addresses []peer.Address) []peer.Address {
+		return peer.FilterAddresses(addresses, peer.Family(family))
+	},
 }
 
 type TemplateContext struct {